@@ -0,0 +1,220 @@
+package ipset
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Backend runs ipset commands for a Client. The args are the
+// command line arguments of the ipset utility without the
+// program name, i.e.
+//      add foo 1.1.1.1 timeout 60
+// and stdin, if not nil, is fed to the command the way ipset
+// restore reads it. The combined output is returned in the same
+// format the ipset utility prints it, so that the callers can
+// parse it without knowing which backend is in use.
+//
+// A Backend can be implemented to record or fake the commands,
+// i.e. in tests.
+type Backend interface {
+	// Run executes the command. The command is aborted as soon
+	// as ctx is done.
+	Run(ctx context.Context, stdin []byte, args ...string) ([]byte, error)
+
+	// Check checks whether the backend is usable on this system.
+	Check() error
+}
+
+// NewExecBackend returns a Backend which executes the ipset
+// utility found in os path by Check, or the one configured by
+// options.
+func NewExecBackend(options ...ExecOption) Backend {
+	b := &execBackend{}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+// ExecOption configures the ipset utility executed by the Backend
+// of NewExecBackend.
+type ExecOption func(b *execBackend)
+
+// ExecPath option sets the ipset utility to execute instead of the
+// ipset found in os path, i.e. /usr/sbin/ipset-legacy. A name
+// without slash is still looked up in os path by Check.
+func ExecPath(path string) ExecOption {
+	return func(b *execBackend) {
+		b.binary = path
+	}
+}
+
+// ExecWrapper option runs the ipset utility by a wrapper command,
+// i.e. a privilege helper:
+//      ipset.ExecWrapper("sudo", "-n")
+// The path of ipset and its arguments are appended to the wrapper.
+func ExecWrapper(command ...string) ExecOption {
+	return func(b *execBackend) {
+		b.wrapper = command
+	}
+}
+
+// ExecEnv option adds the environment variables in the form of
+// key=value to the environment of the process for the ipset
+// utility, i.e. LANG=C.
+func ExecEnv(env ...string) ExecOption {
+	return func(b *execBackend) {
+		b.env = append(b.env, env...)
+	}
+}
+
+// NewNetlinkBackend returns a Backend which speaks the ipset
+// netlink protocol to the kernel directly. It's only supported
+// on linux.
+func NewNetlinkBackend() Backend {
+	return newNetlinkBackend()
+}
+
+// versionedBackend is implemented by the backends which know the
+// version of the ipset utility, so that the options requiring a
+// newer one are rejected before running the command.
+type versionedBackend interface {
+	utilVersion() (major, minor int)
+}
+
+// batchTester is implemented by the backends which test many
+// entries in one pass. Unlike restore, which stops at the first
+// entry not in the set, testAll goes on and returns the error of
+// each line of args.
+type batchTester interface {
+	testAll(ctx context.Context, lines [][]string) ([]error, error)
+}
+
+// testerOf returns the batchTester of b, or nil if b can't test
+// many entries in one pass.
+func testerOf(b Backend) batchTester {
+	if nb, ok := b.(*netnsBackend); ok && testerOf(nb.Backend) == nil {
+		return nil
+	}
+	bt, _ := b.(batchTester)
+	return bt
+}
+
+// execBackend forks the ipset utility found by Check.
+type execBackend struct {
+	path string
+	// binary is the configured ipset utility to find
+	binary  string
+	wrapper []string
+	env     []string
+	// major and minor are the version detected by Check
+	major, minor int
+}
+
+func (b *execBackend) Run(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	return b.command(ctx, stdin, args...).CombinedOutput()
+}
+
+// command builds the command of args with the wrapper and env.
+func (b *execBackend) command(ctx context.Context, stdin []byte, args ...string) *exec.Cmd {
+	path := b.path
+	if path == "" {
+		path = b.binary
+	}
+	name := path
+	if len(b.wrapper) > 0 {
+		name = b.wrapper[0]
+		args = append(append(append([]string(nil), b.wrapper[1:]...), path), args...)
+	}
+	c := execCommandContext(ctx, name, args...)
+	if len(b.env) > 0 {
+		if c.Env == nil {
+			c.Env = os.Environ()
+		}
+		c.Env = append(c.Env, b.env...)
+	}
+	if stdin != nil {
+		c.Stdin = bytes.NewReader(stdin)
+	}
+	return c
+}
+
+func (b *execBackend) Check() error {
+	if b.path != "" {
+		return nil
+	}
+
+	name := "ipset"
+	if b.binary != "" {
+		name = b.binary
+	}
+	path, err := execLookPath(name)
+	if err != nil {
+		return ErrNotFound
+	}
+	b.path = path
+
+	var supported bool
+	if supported, err = b.isSupported(); err != nil {
+		return fmt.Errorf("ipset: can't check version : %s", err)
+	}
+
+	if supported {
+		return nil
+	}
+	return ErrVersionNotSupported
+}
+
+func (b *execBackend) utilVersion() (major, minor int) {
+	return b.major, b.minor
+}
+
+func (b *execBackend) isSupported() (bool, error) {
+	out, err := b.Run(context.Background(), nil, _version)
+
+	if err == nil {
+		b.major, b.minor = getVersion(out)
+		return b.major >= minMajorVersion, nil
+	}
+
+	return false, err
+}
+
+// netnsBackend runs the commands of a backend in a network
+// namespace, see WithNetNS.
+type netnsBackend struct {
+	Backend
+	path  string
+	enter func(path string, fn func()) error
+}
+
+func (b *netnsBackend) Run(ctx context.Context, stdin []byte, args ...string) (out []byte, err error) {
+	if e := b.enter(b.path, func() { out, err = b.Backend.Run(ctx, stdin, args...) }); e != nil {
+		return []byte(e.Error() + "\n"), e
+	}
+	return out, err
+}
+
+func (b *netnsBackend) Check() (err error) {
+	if e := b.enter(b.path, func() { err = b.Backend.Check() }); e != nil {
+		return fmt.Errorf("ipset: %w", e)
+	}
+	return err
+}
+
+func (b *netnsBackend) utilVersion() (major, minor int) {
+	if vb, ok := b.Backend.(versionedBackend); ok {
+		return vb.utilVersion()
+	}
+	return 0, 0
+}
+
+func (b *netnsBackend) testAll(ctx context.Context, lines [][]string) (errs []error, err error) {
+	if e := b.enter(b.path, func() { errs, err = testerOf(b.Backend).testAll(ctx, lines) }); e != nil {
+		return nil, e
+	}
+	return errs, err
+}
@@ -0,0 +1,246 @@
+package ipset
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BatchError is returned by AddMany, DelMany and TestMany if some
+// of the entries fail, the others are applied anyway.
+type BatchError struct {
+	// Failed are the indexes of the failed entries.
+	Failed []int
+	// Errors are the errors of the failed entries in the same
+	// order as Failed.
+	Errors []*OpError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e.Errors[0].Error(), len(e.Errors)-1)
+}
+
+func (s set) AddMany(entries []string, options ...Option) error {
+	return s.AddManyContext(context.Background(), entries, options...)
+}
+
+func (s set) AddManyContext(ctx context.Context, entries []string, options ...Option) error {
+	return s.batch(ctx, _add, entries, options...)
+}
+
+func (s set) DelMany(entries []string, options ...Option) error {
+	return s.DelManyContext(context.Background(), entries, options...)
+}
+
+func (s set) DelManyContext(ctx context.Context, entries []string, options ...Option) error {
+	return s.batch(ctx, _del, entries, options...)
+}
+
+func (s set) TestMany(entries []string, options ...Option) (map[string]bool, error) {
+	return s.TestManyContext(context.Background(), entries, options...)
+}
+
+func (s set) TestManyContext(ctx context.Context, entries []string, options ...Option) (map[string]bool, error) {
+	var err error
+	if bt := testerOf(s.client.backend); bt != nil {
+		err = s.testAll(ctx, bt, entries, options...)
+	} else {
+		err = s.batch(ctx, _test, entries, options...)
+	}
+	var batchErr *BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		return nil, err
+	}
+
+	results := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		results[entry] = true
+	}
+	if batchErr == nil {
+		return results, nil
+	}
+
+	// the entries not in the set fail the same way as errors
+	failed := &BatchError{}
+	for i, e := range batchErr.Errors {
+		results[e.Entry] = false
+		if !notInSet([]byte(e.Output)) {
+			failed.Failed = append(failed.Failed, batchErr.Failed[i])
+			failed.Errors = append(failed.Errors, e)
+		}
+	}
+	if len(failed.Errors) > 0 {
+		return results, failed
+	}
+	return results, nil
+}
+
+// testAll tests entries in one pass of bt. The failed entries are
+// reported by a *BatchError the same way as restoreLines does.
+func (s set) testAll(ctx context.Context, bt batchTester, entries []string, options ...Option) error {
+	lines, err := s.batchLines(_test, entries, options...)
+	if err != nil {
+		return err
+	}
+	args := make([][]string, len(lines))
+	for i, line := range lines {
+		args[i] = line.args
+	}
+
+	errs, err := bt.testAll(ctx, args)
+	if err != nil {
+		return &OpError{Action: _test, Set: s.name, Err: err, op: _test + " " + s.name}
+	}
+	batchErr := &BatchError{}
+	for i, e := range errs {
+		if e != nil {
+			batchErr.Failed = append(batchErr.Failed, i)
+			batchErr.Errors = append(batchErr.Errors, s.lineError(lines[i], e.Error()+"\n"))
+		}
+	}
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+// batchLine is a line of restore run by restoreLines.
+type batchLine struct {
+	action string
+	entry  string
+	args   []string
+}
+
+// batch runs the action of entries by restore.
+func (s set) batch(ctx context.Context, action string, entries []string, options ...Option) error {
+	lines, err := s.batchLines(action, entries, options...)
+	if err != nil {
+		return err
+	}
+	return s.restoreLines(ctx, lines)
+}
+
+// batchLines builds the lines of the action of entries.
+func (s set) batchLines(action string, entries []string, options ...Option) ([]batchLine, error) {
+	lines := make([]batchLine, len(entries))
+	for i, entry := range entries {
+		c := getCmd(action, s.name, s.setType, entry)
+		if i == 0 {
+			if err := c.check(options...); err != nil {
+				putCmd(c)
+				return nil, err
+			}
+		}
+		lines[i] = batchLine{action, entry, c.buildArgs(options...)}
+		putCmd(c)
+	}
+	return lines, nil
+}
+
+// restoreLines runs lines by restore. Since restore stops at the
+// first failed line, the rest lines are restored again until all
+// of them are done.
+func (s set) restoreLines(ctx context.Context, lines []batchLine) error {
+	var (
+		exist bool
+		texts = make([]string, len(lines))
+	)
+	for i, line := range lines {
+		var e bool
+		if texts[i], e = restoreLine(line.args); e {
+			exist = true
+		}
+	}
+
+	batchErr := &BatchError{}
+	for start := 0; start < len(texts); {
+		b := &bytes.Buffer{}
+		end := start
+		for end < len(texts) && (end == start || b.Len()+len(texts[end]) < maxRestoreSize) {
+			b.WriteString(texts[end])
+			b.WriteByte('\n')
+			end++
+		}
+
+		err := s.restore(ctx, b.Bytes(), exist)
+		if err == nil {
+			start = end
+			continue
+		}
+		n, msg := failedLine(err)
+		if n < 1 || start+n > end {
+			return err
+		}
+
+		i := start + n - 1
+		batchErr.Failed = append(batchErr.Failed, i)
+		batchErr.Errors = append(batchErr.Errors, s.lineError(lines[i], msg))
+		start = i + 1
+	}
+
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+// lineError is the error of a failed line whose output is msg.
+func (s set) lineError(line batchLine, msg string) *OpError {
+	e := &OpError{
+		Action: line.action,
+		Set:    s.name,
+		Entry:  line.entry,
+		Args:   line.args,
+		Output: msg,
+		Err:    classify([]byte(msg)),
+		op:     line.action + " " + s.name + " " + line.entry,
+	}
+	if e.Err == nil {
+		e.Err = errors.New(strings.TrimSpace(msg))
+	}
+	return e
+}
+
+// restoreLine joins args to a line of restore, the exist flag is
+// stripped from args and returned since it's global to restore.
+func restoreLine(args []string) (line string, exist bool) {
+	var b strings.Builder
+	for i, arg := range args {
+		if arg == _exist {
+			exist = true
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		if i > 0 && args[i-1] == _comment {
+			arg = `"` + arg + `"`
+		}
+		b.WriteString(arg)
+	}
+	return b.String(), exist
+}
+
+var lineErrorRegexp = regexp.MustCompile(`Error in line (\d+): (.*)`)
+
+// failedLine returns the line number and the message reported by
+// restore, line is zero if err is not reported for a line.
+func failedLine(err error) (line int, msg string) {
+	var e *OpError
+	if !errors.As(err, &e) {
+		return
+	}
+	m := lineErrorRegexp.FindStringSubmatch(e.Output)
+	if m == nil {
+		return
+	}
+	line, _ = strconv.Atoi(m[1])
+	return line, m[2]
+}
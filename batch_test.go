@@ -0,0 +1,167 @@
+package ipset
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Set_AddMany(t *testing.T) {
+	t.Run("lines", func(t *testing.T) {
+		b := &fakeBackend{}
+		s := &set{"foo", HashIp, NewClient(b), nil}
+
+		require.Nil(t, s.AddMany([]string{"1.1.1.1", "1.1.1.2"},
+			Timeout(time.Minute), CommentContent("a b"), Exist(true)))
+		assert.Equal(t, [][]string{{_restore, _exist}}, b.args)
+		assert.Equal(t, "add foo 1.1.1.1 timeout 60 comment \"a b\"\n"+
+			"add foo 1.1.1.2 timeout 60 comment \"a b\"\n", string(b.stdin[0]))
+
+		require.Nil(t, s.DelMany([]string{"1.1.1.1"}))
+		assert.Equal(t, []string{_restore}, b.args[1])
+		assert.Equal(t, "del foo 1.1.1.1\n", string(b.stdin[1]))
+	})
+
+	t.Run("chunks", func(t *testing.T) {
+		old := maxRestoreSize
+		maxRestoreSize = 40
+		defer func() { maxRestoreSize = old }()
+
+		b := &fakeBackend{}
+		s := &set{"foo", HashIp, NewClient(b), nil}
+		require.Nil(t, s.AddMany([]string{"1.1.1.1", "1.1.1.2", "1.1.1.3"}))
+		assert.Equal(t, []string{"add foo 1.1.1.1\nadd foo 1.1.1.2\n", "add foo 1.1.1.3\n"},
+			[]string{string(b.stdin[0]), string(b.stdin[1])})
+	})
+
+	t.Run("failed entries", func(t *testing.T) {
+		k := newFakeKernel()
+		c := NewClient(k.backend())
+		s, err := c.New("foo", HashIp)
+		require.Nil(t, err)
+		require.Nil(t, s.Add("1.1.1.2"))
+		require.Nil(t, s.Add("1.1.1.4"))
+
+		err = s.AddMany([]string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4"})
+		require.Error(t, err)
+		var batchErr *BatchError
+		require.True(t, errors.As(err, &batchErr))
+		assert.Equal(t, []int{1, 3}, batchErr.Failed)
+		assert.Equal(t, "1.1.1.2", batchErr.Errors[0].Entry)
+		assert.True(t, errors.Is(batchErr.Errors[1], ErrEntryExists))
+		assert.Equal(t, "ipset: can't add foo 1.1.1.2: Element cannot be added to the set: "+
+			"it's already added (and 1 more errors)", err.Error())
+
+		info, err := s.List()
+		require.Nil(t, err)
+		assert.Len(t, info.Entries, 4)
+
+		err = s.DelMany([]string{"1.1.1.5", "1.1.1.1"})
+		require.True(t, errors.As(err, &batchErr))
+		assert.Equal(t, []int{0}, batchErr.Failed)
+		assert.True(t, errors.Is(batchErr.Errors[0], ErrEntryNotExist))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		s := &set{"foo", HashIp, NewClient(&fakeBackend{out: "fake error", err: errors.New("exit")}), nil}
+		err := s.AddMany([]string{"1.1.1.1"})
+		require.Error(t, err)
+		assert.Equal(t, "ipset: can't restore to foo(hash:ip): fake error", err.Error())
+	})
+}
+
+func Test_Set_TestMany(t *testing.T) {
+	k := newFakeKernel()
+	c := NewClient(k.backend())
+	s, err := c.New("foo", HashNet)
+	require.Nil(t, err)
+	require.Nil(t, s.Add("10.0.0.0/8"))
+	require.Nil(t, s.Add("10.1.0.0/16", Nomatch(true)))
+
+	results, err := s.TestMany([]string{"10.0.0.0/8", "10.2.0.0/16", "10.1.0.0/16"})
+	require.Nil(t, err)
+	assert.Equal(t, map[string]bool{"10.0.0.0/8": true, "10.2.0.0/16": false, "10.1.0.0/16": false}, results)
+
+	results, err = s.TestMany([]string{"10.1.0.0/16"}, Nomatch(true))
+	require.Nil(t, err)
+	assert.Equal(t, map[string]bool{"10.1.0.0/16": true}, results)
+
+	ok, err := s.Test("10.1.0.0/16", Nomatch(true))
+	require.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = s.Test("10.1.0.0/16")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	results, err = s.TestMany([]string{"10.0.0.0/8", "bad", "10.3.0.0/16"})
+	var batchErr *BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, []int{1}, batchErr.Failed)
+	assert.Equal(t, map[string]bool{"10.0.0.0/8": true, "bad": false, "10.3.0.0/16": false}, results)
+
+	b := &fakeBackend{}
+	s = &set{"foo", HashNet, NewClient(b), nil}
+	_, err = s.TestMany([]string{"10.0.0.0/8"}, Nomatch(true), Timeout(time.Minute))
+	require.Nil(t, err)
+	assert.Equal(t, "test foo 10.0.0.0/8 nomatch\n", string(b.stdin[0]))
+}
+
+// countBackend counts the commands run by a backend, it hides the
+// batchTester of the backend.
+type countBackend struct {
+	Backend
+	runs int
+}
+
+func (b *countBackend) Run(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	b.runs++
+	return b.Backend.Run(ctx, stdin, args...)
+}
+
+func Test_Set_TestMany_Passes(t *testing.T) {
+	entries := []string{"10.0.0.0/8", "10.2.0.0/16", "10.3.0.0/16", "10.4.0.0/16", "10.5.0.0/16"}
+	want := map[string]bool{"10.0.0.0/8": true, "10.2.0.0/16": false,
+		"10.3.0.0/16": false, "10.4.0.0/16": false, "10.5.0.0/16": false}
+
+	t.Run("netlink", func(t *testing.T) {
+		k := newFakeKernel()
+		dials := 0
+		b := &netlinkBackend{dial: func() (nlConn, error) {
+			dials++
+			return k, nil
+		}}
+		s, err := NewClient(b).New("foo", HashNet)
+		require.Nil(t, err)
+		require.Nil(t, s.Add("10.0.0.0/8"))
+
+		dials = 0
+		results, err := s.TestMany(entries)
+		require.Nil(t, err)
+		assert.Equal(t, want, results)
+		assert.Equal(t, 1, dials)
+	})
+
+	t.Run("netns", func(t *testing.T) {
+		enter := func(path string, fn func()) error { fn(); return nil }
+		assert.Nil(t, testerOf(&netnsBackend{Backend: &fakeBackend{}, enter: enter}))
+		assert.NotNil(t, testerOf(&netnsBackend{Backend: newFakeKernel().backend(), enter: enter}))
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		b := &countBackend{Backend: newFakeKernel().backend()}
+		s, err := NewClient(b).New("foo", HashNet)
+		require.Nil(t, err)
+		require.Nil(t, s.Add("10.0.0.0/8"))
+
+		b.runs = 0
+		results, err := s.TestMany(entries)
+		require.Nil(t, err)
+		assert.Equal(t, want, results)
+		// one restore per entry not in the set
+		assert.Equal(t, 4, b.runs)
+	})
+}
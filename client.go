@@ -0,0 +1,270 @@
+package ipset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Client manages sets through its Backend. Clients are
+// independent of each other, so several configurations, such
+// as different ipset utilities or the netlink protocol, can be
+// used in one process.
+type Client struct {
+	backend Backend
+}
+
+// std is the client used by the package level functions.
+var std = NewClient(NewExecBackend())
+
+// NewClient creates a client running commands by backend.
+func NewClient(backend Backend, options ...ClientOption) *Client {
+	c := &Client{backend: backend}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+// ClientOption configures a Client created by NewClient.
+type ClientOption func(c *Client)
+
+// WithNetNS makes the client manage the sets of the network
+// namespace at path, i.e. /var/run/netns/foo or /proc/<pid>/ns/net,
+// instead of the one of the process. Every command, as well as
+// Check, runs on a locked os thread switched to the namespace:
+// the exec backend forks ipset there and the netlink backend opens
+// its socket there. It requires CAP_SYS_ADMIN and is only
+// supported on linux.
+func WithNetNS(path string) ClientOption {
+	return func(c *Client) {
+		c.backend = &netnsBackend{Backend: c.backend, path: path, enter: inNetNS}
+	}
+}
+
+// Check checks whether the backend of the client is usable,
+// see Check and CheckNetlink.
+func (c *Client) Check() error {
+	return c.backend.Check()
+}
+
+// New create a set identified with setname and specified type,
+// see New.
+func (c *Client) New(name string, setType SetType, options ...Option) (IPSet, error) {
+	return c.NewContext(context.Background(), name, setType, options...)
+}
+
+// NewContext is like New but aborts as soon as ctx is done.
+func (c *Client) NewContext(ctx context.Context, name string, setType SetType, options ...Option) (IPSet, error) {
+	cmd := getCmd(_create, name, setType, string(setType))
+	defer putCmd(cmd)
+	if err := cmd.exec(ctx, c.backend, options...); err != nil {
+		return nil, err
+	}
+	return &set{name, setType, c, createHeader(setType, options...)}, nil
+}
+
+// Open returns the existing set identified with setname. Its
+// type is discovered from kernel, so that the set needn't be
+// created again with the exact type and options. If there is no
+// such set, an error wrapping ErrSetNotExist is returned.
+func (c *Client) Open(name string) (IPSet, error) {
+	return c.OpenContext(context.Background(), name)
+}
+
+// OpenContext is like Open but aborts as soon as ctx is done.
+func (c *Client) OpenContext(ctx context.Context, name string) (IPSet, error) {
+	info, err := c.info(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &set{name, info.SetType, c, &info.SetHeader}, nil
+}
+
+// info lists the header data of the set without entries.
+func (c *Client) info(ctx context.Context, name string) (*Info, error) {
+	out, err := run(ctx, c.backend, "open set "+name, nil, _list, name, _terse)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := parseInfo("", out)
+	if err != nil {
+		return nil, fmt.Errorf("ipset: can't open set %s: %s", name, err)
+	}
+	if info.SetType == "" {
+		return nil, fmt.Errorf("ipset: can't open set %s: unknown set type", name)
+	}
+	return info, nil
+}
+
+// Filter selects the sets listed by ListAll and ListNames.
+type Filter func(info *Info) bool
+
+// TypeFilter selects the sets of any of the given types.
+func TypeFilter(types ...SetType) Filter {
+	return func(info *Info) bool {
+		for _, t := range types {
+			if info.SetType == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PrefixFilter selects the sets whose names start with prefix.
+func PrefixFilter(prefix string) Filter {
+	return func(info *Info) bool {
+		return strings.HasPrefix(info.Name, prefix)
+	}
+}
+
+func match(info *Info, filters []Filter) bool {
+	for _, filter := range filters {
+		if !filter(info) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListAll dumps header data and the entries of all sets selected
+// by filters.
+func (c *Client) ListAll(filters ...Filter) ([]*Info, error) {
+	return c.ListAllContext(context.Background(), filters...)
+}
+
+// ListAllContext is like ListAll but aborts as soon as ctx is
+// done.
+func (c *Client) ListAllContext(ctx context.Context, filters ...Filter) ([]*Info, error) {
+	return c.listAll(ctx, filters)
+}
+
+// ListNames lists the names of all sets selected by filters. It
+// is cheap without filters since only the names are dumped,
+// otherwise the headers are dumped as well.
+func (c *Client) ListNames(filters ...Filter) ([]string, error) {
+	return c.ListNamesContext(context.Background(), filters...)
+}
+
+// ListNamesContext is like ListNames but aborts as soon as ctx is
+// done.
+func (c *Client) ListNamesContext(ctx context.Context, filters ...Filter) ([]string, error) {
+	var names []string
+	if len(filters) == 0 {
+		out, err := run(ctx, c.backend, "list all set", nil, _list, _names)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range strings.Split(string(out), "\n") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+
+	infos, err := c.listAll(ctx, filters, _terse)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	return names, nil
+}
+
+func (c *Client) listAll(ctx context.Context, filters []Filter, flags ...string) ([]*Info, error) {
+	out, err := run(ctx, c.backend, "list all set", nil, append([]string{_list}, flags...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := parseInfos(out)
+	if err != nil {
+		return nil, fmt.Errorf("ipset: can't list all set: %s", err)
+	}
+	selected := infos[:0]
+	for _, info := range infos {
+		if match(info, filters) {
+			selected = append(selected, info)
+		}
+	}
+	return selected, nil
+}
+
+// Flush all entries from the specified set or flush all sets if
+// none is given.
+func (c *Client) Flush(names ...string) error {
+	return c.FlushContext(context.Background(), names...)
+}
+
+// FlushContext is like Flush but aborts as soon as ctx is done.
+func (c *Client) FlushContext(ctx context.Context, names ...string) error {
+	if len(names) > 0 {
+		for _, name := range names {
+			if err := c.flush(ctx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.flushAll(ctx)
+}
+
+// flush flushes specific set
+func (c *Client) flush(ctx context.Context, name string) error {
+	_, err := run(ctx, c.backend, "flush set "+name, nil, _flush, name)
+	return err
+}
+
+// flushAll flushes all set
+func (c *Client) flushAll(ctx context.Context) error {
+	_, err := run(ctx, c.backend, "flush all set", nil, _flush)
+	return err
+}
+
+// Destroy removes the specified set or all the sets if none is
+// given. If the set has got reference(s), nothing is done and no
+// set destroyed.
+func (c *Client) Destroy(names ...string) error {
+	return c.DestroyContext(context.Background(), names...)
+}
+
+// DestroyContext is like Destroy but aborts as soon as ctx is done.
+func (c *Client) DestroyContext(ctx context.Context, names ...string) error {
+	if len(names) > 0 {
+		for _, name := range names {
+			if err := c.destroy(ctx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.destroyAll(ctx)
+}
+
+// destroy removes specific set
+func (c *Client) destroy(ctx context.Context, name string) error {
+	_, err := run(ctx, c.backend, "destroy set "+name, nil, _destroy, name)
+	return err
+}
+
+// destroyAll removes all set
+func (c *Client) destroyAll(ctx context.Context) error {
+	_, err := run(ctx, c.backend, "destroy all set", nil, _destroy)
+	return err
+}
+
+// Swap swaps the content of two sets. The referred sets must
+// exist and compatible type of sets can be swapped only.
+func (c *Client) Swap(from, to string) error {
+	return c.SwapContext(context.Background(), from, to)
+}
+
+// SwapContext is like Swap but aborts as soon as ctx is done.
+func (c *Client) SwapContext(ctx context.Context, from, to string) error {
+	_, err := run(ctx, c.backend, "swap from "+from+" to "+to, nil, _swap, from, to)
+	return err
+}
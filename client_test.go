@@ -0,0 +1,261 @@
+package ipset
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Client_Check(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, NewClient(&fakeBackend{}).Check())
+
+	err := errors.New("check")
+	assert.Equal(t, err, NewClient(&fakeBackend{err: err}).Check())
+}
+
+func Test_Client_New(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		b := &fakeBackend{}
+		c := NewClient(b)
+
+		s, err := c.New("foo", HashIp, Exist(true))
+		require.Nil(t, err)
+		require.Nil(t, s.Add("1.1.1.1"))
+		assert.Equal(t, [][]string{
+			{_create, "foo", string(HashIp), _exist},
+			{_add, "foo", "1.1.1.1"},
+		}, b.args)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c := NewClient(&fakeBackend{out: "fake error", err: errors.New("exit")})
+
+		_, err := c.New("foo", HashIp)
+		require.Error(t, err)
+		assert.Equal(t, "ipset: can't create foo hash:ip: fake error", err.Error())
+	})
+}
+
+func Test_Client_Flush(t *testing.T) {
+	t.Parallel()
+
+	b := &fakeBackend{}
+	c := NewClient(b)
+	require.Nil(t, c.Flush())
+	require.Nil(t, c.Flush("a", "b"))
+	assert.Equal(t, [][]string{{_flush}, {_flush, "a"}, {_flush, "b"}}, b.args)
+
+	b.out, b.err = "fake error", errors.New("exit")
+	assert.Equal(t, "ipset: can't flush set a: fake error", c.Flush("a").Error())
+}
+
+func Test_Client_Destroy(t *testing.T) {
+	t.Parallel()
+
+	b := &fakeBackend{}
+	c := NewClient(b)
+	require.Nil(t, c.Destroy())
+	require.Nil(t, c.Destroy("a"))
+	assert.Equal(t, [][]string{{_destroy}, {_destroy, "a"}}, b.args)
+
+	b.out, b.err = "fake error", errors.New("exit")
+	assert.Equal(t, "ipset: can't destroy all set: fake error", c.Destroy().Error())
+}
+
+func Test_Client_Swap(t *testing.T) {
+	t.Parallel()
+
+	b := &fakeBackend{}
+	c := NewClient(b)
+	require.Nil(t, c.Swap("a", "b"))
+	assert.Equal(t, [][]string{{_swap, "a", "b"}}, b.args)
+}
+
+func Test_Client_Context(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b := &fakeBackend{}
+	c := NewClient(b)
+
+	_, err := c.NewContext(ctx, "foo", HashIp)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "ipset: can't create foo hash:ip: context canceled", err.Error())
+	assert.True(t, errors.Is(c.FlushContext(ctx, "a"), context.Canceled))
+	assert.True(t, errors.Is(c.FlushContext(ctx), context.Canceled))
+	assert.True(t, errors.Is(c.DestroyContext(ctx, "a"), context.Canceled))
+	assert.True(t, errors.Is(c.DestroyContext(ctx), context.Canceled))
+	assert.True(t, errors.Is(c.SwapContext(ctx, "a", "b"), context.Canceled))
+
+	s := &set{"foo", HashIp, c, nil}
+	assert.True(t, errors.Is(s.AddContext(ctx, "1.1.1.1"), context.Canceled))
+	_, err = s.TestContext(ctx, "1.1.1.1")
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, err = s.ListContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	err = s.RestoreContext(ctx, strings.NewReader("add foo 1.1.1.1\n"))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Len(t, b.args, 0)
+}
+
+func Test_Client_Open(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		b := &fakeBackend{out: listInfo}
+		c := NewClient(b)
+
+		s, err := c.Open("foo")
+		require.Nil(t, err)
+		assert.Equal(t, "foo", s.Name())
+		assert.Equal(t, HashIp, s.(*set).setType)
+		assert.Equal(t, [][]string{{_list, "foo", _terse}}, b.args)
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		c := NewClient(&fakeBackend{
+			out: "ipset v7.1: The set with the given name does not exist\n",
+			err: errors.New("exit"),
+		})
+
+		_, err := c.Open("foo")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrSetNotExist))
+		assert.Equal(t, "ipset: can't open set foo: ipset v7.1: The set with the given name does not exist\n", err.Error())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := NewClient(&fakeBackend{out: "fake error", err: errors.New("exit")}).Open("foo")
+		require.Error(t, err)
+		assert.Equal(t, "ipset: can't open set foo: fake error", err.Error())
+
+		_, err = NewClient(&fakeBackend{out: "Name: foo\n"}).Open("foo")
+		require.Error(t, err)
+		assert.Equal(t, "ipset: can't open set foo: unknown set type", err.Error())
+	})
+}
+
+func Test_Client_ListAll(t *testing.T) {
+	t.Parallel()
+
+	out := `Name: foo
+Type: hash:ip
+Revision: 4
+Header: family inet hashsize 1024 maxelem 65536
+Size in memory: 168
+References: 0
+Number of entries: 1
+Members:
+1.1.1.1
+
+Name: bar
+Type: hash:net
+Revision: 6
+Header: family inet hashsize 1024 maxelem 65536
+Size in memory: 448
+References: 1
+Number of entries: 0
+Members:
+
+Name: foo6
+Type: hash:ip
+Revision: 4
+Header: family inet6 hashsize 1024 maxelem 65536
+Size in memory: 168
+References: 0
+Number of entries: 0
+Members:
+`
+
+	t.Run("list all", func(t *testing.T) {
+		b := &fakeBackend{out: out}
+		infos, err := NewClient(b).ListAll()
+		require.Nil(t, err)
+		require.Len(t, infos, 3)
+		assert.Equal(t, "foo", infos[0].Name)
+		assert.Equal(t, []string{"1.1.1.1"}, infos[0].Entries)
+		assert.Equal(t, HashNet, infos[1].SetType)
+		assert.Equal(t, 1, infos[1].References)
+		assert.Equal(t, Inet6, infos[2].SetHeader.Family)
+		assert.Equal(t, [][]string{{_list}}, b.args)
+
+		infos, err = NewClient(b).ListAll(TypeFilter(HashIp), PrefixFilter("foo"))
+		require.Nil(t, err)
+		require.Len(t, infos, 2)
+		assert.Equal(t, "foo6", infos[1].Name)
+	})
+
+	t.Run("list names", func(t *testing.T) {
+		b := &fakeBackend{out: "foo\nbar\nfoo6\n"}
+		names, err := NewClient(b).ListNames()
+		require.Nil(t, err)
+		assert.Equal(t, []string{"foo", "bar", "foo6"}, names)
+		assert.Equal(t, [][]string{{_list, _names}}, b.args)
+
+		b = &fakeBackend{out: out}
+		names, err = NewClient(b).ListNames(TypeFilter(HashNet, HashNetNet))
+		require.Nil(t, err)
+		assert.Equal(t, []string{"bar"}, names)
+		assert.Equal(t, [][]string{{_list, _terse}}, b.args)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c := NewClient(&fakeBackend{out: "fake error", err: errors.New("exit")})
+		_, err := c.ListAll()
+		require.Error(t, err)
+		assert.Equal(t, "ipset: can't list all set: fake error", err.Error())
+
+		_, err = c.ListNames()
+		require.Error(t, err)
+		assert.Equal(t, "ipset: can't list all set: fake error", err.Error())
+
+		_, err = c.ListNames(PrefixFilter("foo"))
+		require.Error(t, err)
+	})
+}
+
+func Test_Client_WithNetNS(t *testing.T) {
+	t.Parallel()
+
+	t.Run("enter", func(t *testing.T) {
+		b := &fakeBackend{}
+		c := NewClient(b, WithNetNS("/var/run/netns/foo"))
+		ns := c.backend.(*netnsBackend)
+		var entered []string
+		ns.enter = func(path string, fn func()) error {
+			entered = append(entered, path)
+			fn()
+			return nil
+		}
+
+		require.Nil(t, c.Check())
+		_, err := c.New("foo", HashIp)
+		require.Nil(t, err)
+		assert.Equal(t, []string{"/var/run/netns/foo", "/var/run/netns/foo"}, entered)
+		assert.Equal(t, [][]string{{_create, "foo", string(HashIp)}}, b.args)
+
+		ns.Backend = &execBackend{major: 7, minor: 1}
+		major, minor := ns.utilVersion()
+		assert.Equal(t, []int{7, 1}, []int{major, minor})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		b := &fakeBackend{}
+		c := NewClient(b, WithNetNS("/not/exist"))
+		_, err := c.New("foo", HashIp)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ipset: can't create foo hash:ip: can't open network namespace")
+		assert.Error(t, c.Check())
+		assert.Len(t, b.args, 0)
+	})
+}
@@ -1,10 +1,13 @@
 package ipset
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Commands
@@ -21,12 +24,15 @@ const (
 	_rename  = "rename"
 	_swap    = "swap"
 	_version = "version"
+	_help    = "help"
 )
 
 // Options
 const (
 	_exist    = "-exist"
 	_resolve  = "-resolve"
+	_terse    = "-terse"
+	_names    = "-name"
 	_timeout  = "timeout"
 	_counters = "counters"
 	_packets  = "packets"
@@ -45,6 +51,10 @@ const (
 	_markmask = "markmask"
 	_size     = "size"
 	_range    = "range"
+
+	_bucketsize = "bucketsize"
+	_initval    = "initval"
+	_bitmask    = "bitmask"
 )
 
 type cmd struct {
@@ -136,10 +146,22 @@ func (c *cmd) appendArgs(args []string, opts ...Option) []string {
 		args = append(args, _maxelem, i2str(uint64(o.maxElem)))
 	}
 
+	if o.bucketsize != 0 && c.needHash() {
+		args = append(args, _bucketsize, i2str(uint64(o.bucketsize)))
+	}
+
+	if o.initval != 0 && c.needHash() {
+		args = append(args, _initval, fmt.Sprintf("0x%08x", o.initval))
+	}
+
 	if o.netmask != 0 && c.needNetmask() {
 		args = append(args, _netmask, i2str(uint64(o.netmask)))
 	}
 
+	if o.bitmask != "" && c.needBitmask() {
+		args = append(args, _bitmask, o.bitmask)
+	}
+
 	if o.markmask != 0 && c.needMarkmask() {
 		args = append(args, _markmask, i2str(uint64(o.markmask)))
 	}
@@ -159,16 +181,167 @@ func (c *cmd) appendArgs(args []string, opts ...Option) []string {
 	return args
 }
 
-func (c *cmd) exec(opts ...Option) error {
-	out, err := execCommand(ipsetPath, c.buildArgs(opts...)...).
-		CombinedOutput()
+// maxTimeout is the largest timeout of ipset.
+const maxTimeout = 2147483 * time.Second
 
-	if err != nil {
-		if c.isTwoArgs() {
-			return fmt.Errorf("ipset: can't %s %s: %s", c.action, c.name, out)
+// check returns an error which lists the options invalid for the
+// action and the set type if the Strict option is given.
+func (c *cmd) check(opts ...Option) error {
+	o := acquireOptions().apply(opts...)
+	defer releaseOptions(o)
+	if !o.strict {
+		return nil
+	}
+
+	target := c.action
+	if c.setType != "" {
+		target += " " + string(c.setType)
+	}
+	var invalid []string
+	for _, opt := range []struct {
+		name         string
+		given, valid bool
+	}{
+		{_timeout, o.timeout > 0, c.needTimeout()},
+		{_exist, o.exist, c.needExist()},
+		{_resolve, o.resolve, c.needResolve()},
+		{_counters, o.counters, c.needCounters()},
+		{_packets, o.countersPackets > 0, c.onlyAdd()},
+		{_bytes, o.countersBytes > 0, c.onlyAdd()},
+		{_comment, o.comment, c.onlyCreate()},
+		{_comment, o.commentContent != "", c.onlyAdd()},
+		{_skbinfo, o.skbinfo, c.onlyCreate()},
+		{_skbmark, o.skbmark != "", c.onlyAdd()},
+		{_skbprio, o.skbprio != "", c.onlyAdd()},
+		{_skbqueue, o.skbqueue != 0, c.onlyAdd()},
+		{_nomatch, o.nomatch, c.needNomatch()},
+		{_forceadd, o.forceadd, c.onlyCreate()},
+		{_family, o.family != "", c.needFamily()},
+		{_hashsize, o.hashSize != 0, c.needHash()},
+		{_maxelem, o.maxElem != 0, c.needHash()},
+		{_bucketsize, o.bucketsize != 0, c.needHash()},
+		{_initval, o.initval != 0, c.needHash()},
+		{_netmask, o.netmask != 0, c.needNetmask()},
+		{_bitmask, o.bitmask != "", c.needBitmask()},
+		{_markmask, o.markmaskSet, c.needMarkmask()},
+		{_size, o.listSize != 0, c.needListSize()},
+		{"ip " + _range, o.ipRange != "", c.needIpRange()},
+		{"port " + _range, o.portRange != "", c.needPortRange()},
+	} {
+		if opt.given && !opt.valid {
+			invalid = append(invalid, opt.name+" is not valid for "+target)
 		}
+	}
 
-		return fmt.Errorf("ipset: can't %s %s %s: %s", c.action, c.name, c.entry, out)
+	if o.timeout > maxTimeout {
+		invalid = append(invalid, fmt.Sprintf("timeout %s exceeds %s", o.timeout, maxTimeout))
+	}
+	if o.family != "" && o.family != Inet && o.family != Inet6 {
+		invalid = append(invalid, fmt.Sprintf("family %s is unknown", o.family))
+	}
+	if o.hashSize&(o.hashSize-1) != 0 {
+		invalid = append(invalid, fmt.Sprintf("hashsize %d is not a power of two", o.hashSize))
+	}
+	if o.bucketsize != 0 && (o.bucketsize < 2 || o.bucketsize > 12) {
+		invalid = append(invalid, fmt.Sprintf("bucketsize %d is out of 2-12", o.bucketsize))
+	}
+	if o.markmaskSet && o.markmask == 0 {
+		invalid = append(invalid, "markmask must be non-zero")
+	}
+	if bits := c.familyBits(o.family); o.netmask > bits {
+		invalid = append(invalid, fmt.Sprintf("netmask %d is out of 1-%d", o.netmask, bits))
+	}
+	if o.bitmask != "" {
+		if o.netmask != 0 {
+			invalid = append(invalid, "bitmask and netmask can't be given together")
+		}
+		if ip := net.ParseIP(o.bitmask); ip == nil || (ip.To4() == nil) != (c.familyBits(o.family) == 128) {
+			invalid = append(invalid, fmt.Sprintf("bitmask %s is not an address of the family", o.bitmask))
+		}
+	}
+
+	if len(invalid) == 0 {
+		return nil
+	}
+	e := &OpError{
+		Action: c.action,
+		Set:    c.name,
+		Err:    fmt.Errorf("%w: %s", ErrInvalidOption, strings.Join(invalid, ", ")),
+		op:     c.op(),
+	}
+	if c.action == _add || c.action == _del || c.action == _test {
+		e.Entry = c.entry
+	}
+	return e
+}
+
+// familyBits returns the bits of the addresses of family.
+func (c *cmd) familyBits(family NetFamily) byte {
+	if family == Inet6 && strings.HasPrefix(string(c.setType), "hash") {
+		return 128
+	}
+	return 32
+}
+
+// versions are the ipset versions the options require.
+var versions = []struct {
+	name         string
+	major, minor int
+	used         func(c *cmd, o *options) bool
+}{
+	{_bucketsize, 7, 10, func(c *cmd, o *options) bool { return o.bucketsize != 0 && c.needHash() }},
+	{_initval, 7, 10, func(c *cmd, o *options) bool { return o.initval != 0 && c.needHash() }},
+	{_bitmask, 7, 17, func(c *cmd, o *options) bool { return o.bitmask != "" && c.needBitmask() }},
+	{_netmask + " of " + string(HashIpPort) + " and " + string(HashNetNet), 7, 17, func(c *cmd, o *options) bool {
+		return o.netmask != 0 && c.needNetmask() && c.setType != BitmapIp && c.setType != HashIp
+	}},
+}
+
+// checkVersion returns an error wrapping ErrOptionNotSupported if
+// the options require a newer ipset utility than the one of b. The
+// options aren't checked if the version is unknown.
+func (c *cmd) checkVersion(b Backend, opts ...Option) error {
+	vb, ok := b.(versionedBackend)
+	if !ok {
+		return nil
+	}
+	major, minor := vb.utilVersion()
+	if major == 0 {
+		return nil
+	}
+
+	o := acquireOptions().apply(opts...)
+	defer releaseOptions(o)
+
+	var unsupported []string
+	for _, v := range versions {
+		if v.used(c, o) && (major < v.major || major == v.major && minor < v.minor) {
+			unsupported = append(unsupported, fmt.Sprintf("%s requires v%d.%d", v.name, v.major, v.minor))
+		}
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+	return &OpError{
+		Action: c.action,
+		Set:    c.name,
+		Err: fmt.Errorf("%w v%d.%d: %s", ErrOptionNotSupported,
+			major, minor, strings.Join(unsupported, ", ")),
+		op: c.op(),
+	}
+}
+
+func (c *cmd) exec(ctx context.Context, b Backend, opts ...Option) error {
+	if err := c.check(opts...); err != nil {
+		return err
+	}
+	if err := c.checkVersion(b, opts...); err != nil {
+		return err
+	}
+	out, err := run(ctx, b, c.op(), nil, c.buildArgs(opts...)...)
+
+	if err != nil {
+		return err
 	}
 
 	if c.needResolve() {
@@ -178,6 +351,15 @@ func (c *cmd) exec(opts ...Option) error {
 	return nil
 }
 
+// op describes the command in errors.
+func (c *cmd) op() string {
+	if c.isTwoArgs() {
+		return c.action + " " + c.name
+	}
+
+	return c.action + " " + c.name + " " + c.entry
+}
+
 func (c *cmd) isTwoArgs() bool {
 	return c.action == _list || c.action == _save ||
 		c.action == _destroy || c.action == _flush
@@ -207,9 +389,11 @@ func (c *cmd) onlyCreate() bool {
 	return c.action == _create
 }
 
+// needNomatch is true for an unknown set type, i.e. an add
+// queued by Tx, and left to ipset to check.
 func (c *cmd) needNomatch() bool {
-	return c.action == _add &&
-		(c.setType == HashNet || c.setType == HashNetNet ||
+	return (c.action == _add || c.action == _test) &&
+		(c.setType == "" || c.setType == HashNet || c.setType == HashNetNet ||
 			c.setType == HashNetPort || c.setType == HashIpPortNet ||
 			c.setType == HashNetPortNet || c.setType == HashNetIface)
 }
@@ -224,7 +408,13 @@ func (c *cmd) needHash() bool {
 
 func (c *cmd) needNetmask() bool {
 	return c.action == _create &&
-		(c.setType == BitmapIp || c.setType == HashIp)
+		(c.setType == BitmapIp || c.setType == HashIp ||
+			c.setType == HashIpPort || c.setType == HashNetNet)
+}
+
+func (c *cmd) needBitmask() bool {
+	return c.action == _create &&
+		(c.setType == HashIp || c.setType == HashIpPort || c.setType == HashNetNet)
 }
 
 func (c *cmd) needMarkmask() bool {
@@ -1,10 +1,12 @@
 package ipset
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -468,6 +470,60 @@ func Test_Options_MaxElem(t *testing.T) {
 	}
 }
 
+func Test_Options_Bucketsize(t *testing.T) {
+	t.Parallel()
+
+	for _, action := range testActions {
+		for _, setType := range testSetTypes {
+			c := getFakeCmd(action, setType)
+			t.Run(action+" "+string(setType)+" without bucketsize", func(t *testing.T) {
+				args := c.appendArgs(nil, Bucketsize(0))
+				assert.Len(t, args, 0)
+			})
+
+			if c.needHash() {
+				t.Run(action+" "+string(setType)+" need bucketsize", func(t *testing.T) {
+					args := c.appendArgs(nil, Bucketsize(2))
+					assert.Equal(t, _bucketsize, args[0])
+					assert.Equal(t, "2", args[1])
+				})
+			} else {
+				t.Run(action+" "+string(setType)+" ignore bucketsize", func(t *testing.T) {
+					args := c.appendArgs(nil, Bucketsize(2))
+					assert.Len(t, args, 0)
+				})
+			}
+		}
+	}
+}
+
+func Test_Options_Initval(t *testing.T) {
+	t.Parallel()
+
+	for _, action := range testActions {
+		for _, setType := range testSetTypes {
+			c := getFakeCmd(action, setType)
+			t.Run(action+" "+string(setType)+" without initval", func(t *testing.T) {
+				args := c.appendArgs(nil, Initval(0))
+				assert.Len(t, args, 0)
+			})
+
+			if c.needHash() {
+				t.Run(action+" "+string(setType)+" need initval", func(t *testing.T) {
+					args := c.appendArgs(nil, Initval(0x5ad1a5b2))
+					assert.Equal(t, _initval, args[0])
+					assert.Equal(t, "0x5ad1a5b2", args[1])
+				})
+			} else {
+				t.Run(action+" "+string(setType)+" ignore initval", func(t *testing.T) {
+					args := c.appendArgs(nil, Initval(0x5ad1a5b2))
+					assert.Len(t, args, 0)
+				})
+			}
+		}
+	}
+}
+
 func Test_Options_Netmask(t *testing.T) {
 	t.Parallel()
 
@@ -495,6 +551,33 @@ func Test_Options_Netmask(t *testing.T) {
 	}
 }
 
+func Test_Options_Bitmask(t *testing.T) {
+	t.Parallel()
+
+	for _, action := range testActions {
+		for _, setType := range testSetTypes {
+			c := getFakeCmd(action, setType)
+			t.Run(action+" "+string(setType)+" without bitmask", func(t *testing.T) {
+				args := c.appendArgs(nil, Bitmask(""))
+				assert.Len(t, args, 0)
+			})
+
+			if c.needBitmask() {
+				t.Run(action+" "+string(setType)+" need bitmask", func(t *testing.T) {
+					args := c.appendArgs(nil, Bitmask("255.0.255.0"))
+					assert.Equal(t, _bitmask, args[0])
+					assert.Equal(t, "255.0.255.0", args[1])
+				})
+			} else {
+				t.Run(action+" "+string(setType)+" ignore bitmask", func(t *testing.T) {
+					args := c.appendArgs(nil, Bitmask("255.0.255.0"))
+					assert.Len(t, args, 0)
+				})
+			}
+		}
+	}
+}
+
 func Test_Options_Markmask(t *testing.T) {
 	t.Parallel()
 
@@ -603,6 +686,111 @@ func Test_Options_ListSize(t *testing.T) {
 	}
 }
 
+func Test_Options_Strict(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid", func(t *testing.T) {
+		for _, action := range testActions {
+			for _, setType := range testSetTypes {
+				c := getFakeCmd(action, setType)
+				assert.Nil(t, c.check(Strict(true)))
+				assert.Nil(t, c.check(Netmask(64), Skbmark("1")))
+			}
+		}
+		assert.Nil(t, getFakeCmd(_create).check(Strict(true), Netmask(24), HashSize(1024), Timeout(time.Hour)))
+		assert.Nil(t, getFakeCmd(_create).check(Strict(true), Family(Inet6), Netmask(64)))
+		assert.Nil(t, getFakeCmd(_create, HashIpMark).check(Strict(true), Markmask(0xff)))
+		assert.Nil(t, getFakeCmd(_create, HashNetNet).check(Strict(true), Family(Inet6), Bitmask("ffff::"), Bucketsize(4)))
+		assert.Nil(t, getFakeCmd(_add, HashNet).check(Strict(true), Nomatch(true), Skbmark("1"), Exist(true)))
+	})
+
+	t.Run("not valid", func(t *testing.T) {
+		c := &cmd{action: _create, name: "test", setType: HashNet, entry: string(HashNet)}
+		err := c.check(Strict(true), Netmask(24), PortRange("1-2"), Skbmark("1"))
+		assert.True(t, errors.Is(err, ErrInvalidOption))
+		assert.Equal(t, "ipset: can't create test hash:net: invalid option: skbmark is not valid for create hash:net, "+
+			"netmask is not valid for create hash:net, port range is not valid for create hash:net", err.Error())
+
+		c = &cmd{action: _del, name: "test", setType: HashIp, entry: "1.1.1.1"}
+		err = c.check(Strict(true), Timeout(time.Minute))
+		assert.Equal(t, "1.1.1.1", err.(*OpError).Entry)
+		assert.Equal(t, "ipset: can't del test 1.1.1.1: invalid option: timeout is not valid for del hash:ip", err.Error())
+	})
+
+	t.Run("values", func(t *testing.T) {
+		for _, opts := range [][]Option{
+			{Netmask(33)},
+			{Family(Inet6), Netmask(129)},
+			{HashSize(1000)},
+			{Timeout(2147484 * time.Second)},
+			{Family("inet4")},
+			{Bucketsize(1)},
+			{Bitmask("255.255.0.0"), Netmask(16)},
+			{Bitmask("ffff::")},
+			{Family(Inet6), Bitmask("255.255.0.0")},
+		} {
+			err := getFakeCmd(_create).check(append(opts, Strict(true))...)
+			assert.True(t, errors.Is(err, ErrInvalidOption), err)
+		}
+		err := getFakeCmd(_create, HashIpMark).check(Strict(true), Markmask(0))
+		assert.Contains(t, err.Error(), "invalid option: markmask must be non-zero")
+	})
+
+	t.Run("commands", func(t *testing.T) {
+		b := &fakeBackend{}
+		c := NewClient(b)
+		_, err := c.New("foo", HashNet, Netmask(24), Strict(true))
+		assert.True(t, errors.Is(err, ErrInvalidOption))
+
+		s, err := c.New("foo", HashNet, Netmask(24))
+		require.Nil(t, err)
+		assert.True(t, errors.Is(s.Add("1.1.1.1", Counters(true), Strict(true)), ErrInvalidOption))
+		assert.True(t, errors.Is(s.AddMany([]string{"1.1.1.1"}, Counters(true), Strict(true)), ErrInvalidOption))
+		assert.Len(t, b.args, 1)
+
+		tx := c.Begin()
+		tx.Add("foo", "1.1.1.1", Counters(true), Strict(true))
+		assert.True(t, errors.Is(tx.Commit(), ErrInvalidOption))
+		assert.Len(t, b.args, 1)
+	})
+}
+
+func Test_Options_Version(t *testing.T) {
+	t.Parallel()
+
+	opts := []Option{Bucketsize(4), Initval(1), Bitmask("255.255.0.0")}
+	c := &cmd{action: _create, name: "test", setType: HashIp, entry: string(HashIp)}
+	assert.Nil(t, c.checkVersion(&fakeBackend{}, opts...))
+	assert.Nil(t, c.checkVersion(&execBackend{}, opts...))
+	assert.Nil(t, c.checkVersion(&execBackend{major: 7, minor: 17}, opts...))
+	assert.Nil(t, getFakeCmd(_add).checkVersion(&execBackend{major: 6, minor: 29}, opts...))
+
+	err := c.checkVersion(&execBackend{major: 7, minor: 10}, opts...)
+	assert.True(t, errors.Is(err, ErrOptionNotSupported))
+	assert.Equal(t, "ipset: can't create test hash:ip: option is not supported by ipset v7.10: bitmask requires v7.17", err.Error())
+
+	err = getFakeCmd(_create, HashIpPort).checkVersion(&execBackend{major: 6, minor: 38}, append(opts, Netmask(24))...)
+	assert.True(t, errors.Is(err, ErrOptionNotSupported))
+	assert.Contains(t, err.Error(), "bucketsize requires v7.10, initval requires v7.10, bitmask requires v7.17, "+
+		"netmask of hash:ip,port and hash:net,net requires v7.17")
+	assert.Nil(t, c.checkVersion(&execBackend{major: 6, minor: 38}, Netmask(24)))
+
+	b := &fakeBackend{}
+	tx := NewClient(&versionedFakeBackend{b}).Begin()
+	tx.Create("foo", HashIp, Bucketsize(4))
+	assert.True(t, errors.Is(tx.Commit(), ErrOptionNotSupported))
+	assert.Len(t, b.args, 0)
+}
+
+// versionedFakeBackend is a fakeBackend of ipset v7.1.
+type versionedFakeBackend struct {
+	*fakeBackend
+}
+
+func (b *versionedFakeBackend) utilVersion() (int, int) {
+	return 7, 1
+}
+
 func getFakeCmd(action string, setType ...SetType) *cmd {
 	st := HashIp
 	if len(setType) > 0 {
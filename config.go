@@ -0,0 +1,254 @@
+package ipset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Config describes the sets managed declaratively by Apply, i.e.
+//
+//      {
+//          "sets": [{
+//              "name": "blocklist",
+//              "type": "hash:net",
+//              "family": "inet",
+//              "timeout": 3600,
+//              "comment": true,
+//              "entries": ["10.0.0.0/8 comment \"private\"", "192.168.0.0/16"]
+//          }],
+//          "destroy_unmanaged": true,
+//          "prefix": "blocklist"
+//      }
+type Config struct {
+	Sets []SetConfig `json:"sets"`
+
+	// DestroyUnmanaged destroys the sets which are not in Sets.
+	// If Prefix is not empty, only the sets whose names start
+	// with it are destroyed.
+	DestroyUnmanaged bool   `json:"destroy_unmanaged,omitempty"`
+	Prefix           string `json:"prefix,omitempty"`
+}
+
+// SetConfig describes a set, its create options and entries.
+type SetConfig struct {
+	Name     string    `json:"name"`
+	Type     SetType   `json:"type"`
+	Family   NetFamily `json:"family,omitempty"`
+	HashSize uint      `json:"hashsize,omitempty"`
+	MaxElem  uint      `json:"maxelem,omitempty"`
+	// Timeout is the default timeout in seconds.
+	Timeout  uint   `json:"timeout,omitempty"`
+	Netmask  byte   `json:"netmask,omitempty"`
+	Markmask uint32 `json:"markmask,omitempty"`
+	Range    string `json:"range,omitempty"`
+	Size     uint   `json:"size,omitempty"`
+	Counters bool   `json:"counters,omitempty"`
+	Comment  bool   `json:"comment,omitempty"`
+	Skbinfo  bool   `json:"skbinfo,omitempty"`
+	Forceadd bool   `json:"forceadd,omitempty"`
+
+	// Entries are in the format ipset lists them, see ParseEntry.
+	// If Entries is nil, i.e. absent in json, the entries of the
+	// set are left untouched, while an empty one flushes the set.
+	Entries []string `json:"entries"`
+}
+
+// LoadConfig decodes and validates the json config from r.
+func LoadConfig(r io.Reader) (*Config, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+
+	cfg := &Config{}
+	if err := d.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("ipset: can't load config: %s", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the names, types and entries of the sets.
+func (cfg *Config) Validate() error {
+	names := make(map[string]bool, len(cfg.Sets))
+	for i := range cfg.Sets {
+		sc := &cfg.Sets[i]
+		if sc.Name == "" || len(sc.Name) >= ipsetMaxNameLen {
+			return fmt.Errorf("ipset: invalid config: invalid set name %q", sc.Name)
+		}
+		if names[sc.Name] {
+			return fmt.Errorf("ipset: invalid config: duplicate set %s", sc.Name)
+		}
+		names[sc.Name] = true
+		if !sc.Type.valid() {
+			return fmt.Errorf("ipset: invalid config: unknown type %q of set %s", sc.Type, sc.Name)
+		}
+		if _, err := sc.entries(); err != nil {
+			return fmt.Errorf("ipset: invalid config: %s", err)
+		}
+	}
+	return nil
+}
+
+// header returns the header of the set configured.
+func (sc *SetConfig) header() *SetHeader {
+	return &SetHeader{
+		Family:   sc.Family,
+		HashSize: sc.HashSize,
+		MaxElem:  sc.MaxElem,
+		Timeout:  time.Duration(sc.Timeout) * time.Second,
+		Netmask:  sc.Netmask,
+		Markmask: sc.Markmask,
+		Range:    sc.Range,
+		Size:     sc.Size,
+		Counters: sc.Counters,
+		Comment:  sc.Comment,
+		Skbinfo:  sc.Skbinfo,
+		Forceadd: sc.Forceadd,
+	}
+}
+
+func (sc *SetConfig) entries() ([]Entry, error) {
+	entries := make([]Entry, 0, len(sc.Entries))
+	for _, s := range sc.Entries {
+		e, err := ParseEntry(sc.Type, s)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, nil
+}
+
+// differs reports whether the current set has to be recreated to
+// match the configured one. The parameters not configured are
+// left to the defaults of ipset, and since kernel grows the hash
+// size of a filling set, only a larger configured one counts.
+func (sc *SetConfig) differs(info *Info) bool {
+	want, cur := sc.header(), &info.SetHeader
+	if sc.Type != info.SetType {
+		return true
+	}
+	if want.Family != "" && want.Family != cur.Family ||
+		want.HashSize > cur.HashSize ||
+		want.MaxElem != 0 && want.MaxElem != cur.MaxElem ||
+		want.Netmask != 0 && want.Netmask != cur.Netmask ||
+		want.Markmask != 0 && want.Markmask != cur.Markmask ||
+		want.Range != "" && want.Range != cur.Range ||
+		want.Size != 0 && want.Size != cur.Size {
+		return true
+	}
+	return want.Timeout != cur.Timeout ||
+		want.Counters != cur.Counters ||
+		want.Comment != cur.Comment ||
+		want.Skbinfo != cur.Skbinfo ||
+		want.Forceadd != cur.Forceadd
+}
+
+// Apply converges the sets on the host to cfg: the missing sets
+// are created, the sets whose type or header differ are
+// recreated via a temporary set and Swap, the entries are synced
+// and the unmanaged sets are destroyed if configured.
+func (c *Client) Apply(cfg *Config) error {
+	return c.ApplyContext(context.Background(), cfg)
+}
+
+// ApplyContext is like Apply but aborts as soon as ctx is done.
+func (c *Client) ApplyContext(ctx context.Context, cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	managed := make(map[string]bool, len(cfg.Sets))
+	for i := range cfg.Sets {
+		managed[cfg.Sets[i].Name] = true
+		if err := c.apply(ctx, &cfg.Sets[i]); err != nil {
+			return err
+		}
+	}
+
+	if !cfg.DestroyUnmanaged {
+		return nil
+	}
+	names, err := c.ListNamesContext(ctx, PrefixFilter(cfg.Prefix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !managed[name] {
+			if err = c.destroy(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) apply(ctx context.Context, sc *SetConfig) error {
+	entries, err := sc.entries()
+	if err != nil {
+		return err
+	}
+	opts := sc.header().Options()
+
+	info, err := c.info(ctx, sc.Name)
+	switch {
+	case errors.Is(err, ErrSetNotExist):
+		s, err := c.NewContext(ctx, sc.Name, sc.Type, opts...)
+		if err != nil {
+			return err
+		}
+		_, err = s.SyncContext(ctx, entries)
+		return err
+	case err != nil:
+		return err
+	case sc.differs(info):
+		return c.recreate(ctx, sc, entries, opts)
+	case sc.Entries == nil:
+		return nil
+	}
+	_, err = (&set{sc.Name, sc.Type, c, nil}).SyncContext(ctx, entries)
+	return err
+}
+
+// recreate creates the configured set as a temporary one and
+// swaps it with the current one. If their types are not
+// compatible for swapping, the current one is destroyed and the
+// temporary one is renamed instead.
+func (c *Client) recreate(ctx context.Context, sc *SetConfig, entries []Entry, opts []Option) (err error) {
+	tmp := tmpName(sc.Name)
+	s, err := c.NewContext(ctx, tmp, sc.Type, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the temporary set is destroyed even if ctx is done
+		if e := c.destroy(context.Background(), tmp); err == nil && !errors.Is(e, ErrSetNotExist) {
+			err = e
+		}
+	}()
+
+	if sc.Entries == nil {
+		// keep the current entries
+		var cur *Info
+		if cur, err = (&set{sc.Name, "", c, nil}).ListContext(ctx); err != nil {
+			return err
+		}
+		entries = cur.Members
+	}
+	if _, err = s.SyncContext(ctx, entries); err != nil {
+		return err
+	}
+
+	if err = c.SwapContext(ctx, tmp, sc.Name); errors.Is(err, ErrTypeIncompatible) {
+		if err = c.destroy(ctx, sc.Name); err != nil {
+			return err
+		}
+		err = s.RenameContext(ctx, sc.Name)
+	}
+	return err
+}
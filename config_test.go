@@ -0,0 +1,106 @@
+package ipset
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadConfig(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		cfg, err := LoadConfig(strings.NewReader(`{
+			"sets": [{
+				"name": "foo",
+				"type": "hash:net",
+				"family": "inet6",
+				"timeout": 60,
+				"comment": true,
+				"entries": ["2001:db8::/32 comment \"x\""]
+			}],
+			"destroy_unmanaged": true,
+			"prefix": "f"
+		}`))
+		require.Nil(t, err)
+		assert.Equal(t, &Config{
+			Sets: []SetConfig{{
+				Name:    "foo",
+				Type:    HashNet,
+				Family:  Inet6,
+				Timeout: 60,
+				Comment: true,
+				Entries: []string{`2001:db8::/32 comment "x"`},
+			}},
+			DestroyUnmanaged: true,
+			Prefix:           "f",
+		}, cfg)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, s := range []string{
+			`{"sets": [{"name": "foo", "type": "hash:ip", "unknown": 1}]}`,
+			`{"sets": [{"name": "", "type": "hash:ip"}]}`,
+			`{"sets": [{"name": "` + strings.Repeat("a", 32) + `", "type": "hash:ip"}]}`,
+			`{"sets": [{"name": "foo", "type": "hash:ip"}, {"name": "foo", "type": "hash:ip"}]}`,
+			`{"sets": [{"name": "foo", "type": "hash:unknown"}]}`,
+			`{"sets": [{"name": "foo", "type": "hash:ip", "entries": ["1.1.1.1 timeout x"]}]}`,
+			`{"sets": [`,
+		} {
+			_, err := LoadConfig(strings.NewReader(s))
+			assert.Error(t, err, s)
+		}
+	})
+}
+
+func Test_Client_Apply(t *testing.T) {
+	k := newFakeKernel()
+	c := NewClient(k.backend())
+
+	cfg := &Config{Sets: []SetConfig{
+		{Name: "foo", Type: HashIp, Entries: []string{"1.1.1.1", "2.2.2.2"}},
+		{Name: "bar", Type: HashNet, Timeout: 60, Entries: []string{"10.0.0.0/8"}},
+	}}
+	require.Nil(t, c.Apply(cfg))
+	assertEntries := func(name string, entries ...string) {
+		info, err := (&set{name, "", c, nil}).List()
+		require.Nil(t, err)
+		assert.Equal(t, entries, info.Entries, name)
+	}
+	assertEntries("foo", "1.1.1.1", "2.2.2.2")
+	assertEntries("bar", "10.0.0.0/8")
+
+	// sync entries, recreate with another header and type and keep
+	// the entries
+	_, err := c.New("baz", HashIp)
+	require.Nil(t, err)
+	cfg.Sets[0].Entries = []string{"2.2.2.2", "3.3.3.3"}
+	cfg.Sets[1].Timeout, cfg.Sets[1].Entries = 0, nil
+	cfg.Sets = append(cfg.Sets, SetConfig{Name: "baz", Type: HashNet, Entries: []string{"10.0.0.0/8"}})
+	require.Nil(t, c.Apply(cfg))
+	assertEntries("foo", "2.2.2.2", "3.3.3.3")
+	assertEntries("bar", "10.0.0.0/8")
+	assertEntries("baz", "10.0.0.0/8")
+
+	info, err := (&set{"bar", "", c, nil}).List()
+	require.Nil(t, err)
+	assert.Equal(t, "family inet hashsize 0 maxelem 0", info.Header)
+	info, err = (&set{"baz", "", c, nil}).List()
+	require.Nil(t, err)
+	assert.Equal(t, HashNet, info.SetType)
+
+	// destroy unmanaged sets
+	_, err = c.New("qux", HashIp)
+	require.Nil(t, err)
+	_, err = c.New("other", HashIp)
+	require.Nil(t, err)
+	cfg.DestroyUnmanaged, cfg.Prefix = true, "q"
+	require.Nil(t, c.Apply(cfg))
+	names, err := c.ListNames()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"foo", "bar", "baz", "other"}, names)
+
+	assert.Error(t, c.Apply(&Config{Sets: []SetConfig{{Name: "x"}}}))
+}
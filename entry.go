@@ -0,0 +1,289 @@
+package ipset
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gonetx/ipset/savefile"
+)
+
+// Entry is a member of a set. Value is the entry the way it is
+// given to Add, Del and Test, the other fields are its
+// components parsed according to the SetType and the
+// extensions listed along with it.
+type Entry struct {
+	// Value is the entry itself, i.e. 1.1.1.1,tcp:80
+	Value string
+
+	// IP, IPTo and CIDR are the first ip or net component.
+	// IPTo is set if a range is given and CIDR is zero if the
+	// component is a plain address. IP is nil if the address
+	// is a host name, i.e. listed with the Resolve option.
+	IP   net.IP
+	IPTo net.IP
+	CIDR int
+
+	// IP2, IP2To and CIDR2 are the second ip or net component
+	// of types like hash:net,net and hash:ip,port,ip.
+	IP2   net.IP
+	IP2To net.IP
+	CIDR2 int
+
+	// Proto, Port and PortTo are the port component. For icmp
+	// and icmpv6 Port holds the type in the high byte and the
+	// code in the low byte, the same way kernel stores it.
+	Proto  string
+	Port   uint16
+	PortTo uint16
+
+	// MAC is the mac component.
+	MAC net.HardwareAddr
+
+	// Iface is the iface component and Physdev is true if it
+	// has the physdev: prefix.
+	Iface   string
+	Physdev bool
+
+	// Mark is the mark component of hash:ip,mark.
+	Mark uint32
+
+	// Name is the member set of list:set.
+	Name string
+
+	Timeout  time.Duration
+	Packets  uint
+	Bytes    uint
+	Comment  string
+	Skbmark  string
+	Skbprio  string
+	Skbqueue uint
+	Nomatch  bool
+}
+
+// ParseEntry parses an entry of setType along with its
+// extensions, i.e. a member line listed by ipset:
+//      1.1.1.1,tcp:80 timeout 3599 packets 0 bytes 0 comment "x"
+func ParseEntry(setType SetType, s string) (*Entry, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("ipset: empty entry of %s", setType)
+	}
+	args, err := savefile.Split(s)
+	if err != nil {
+		return nil, fmt.Errorf("ipset: can't parse entry %q of %s: %s", s, setType, err)
+	}
+
+	e := &Entry{Value: args[0]}
+	if err = e.parseValue(setType); err != nil {
+		return nil, fmt.Errorf("ipset: can't parse entry %q of %s: %s", e.Value, setType, err)
+	}
+	if err = e.parseExtensions(args[1:]); err != nil {
+		return nil, fmt.Errorf("ipset: can't parse entry %q of %s: %s", s, setType, err)
+	}
+	return e, nil
+}
+
+func (e *Entry) parseValue(setType SetType) (err error) {
+	if setType == ListSet {
+		e.Name = e.Value
+		return nil
+	}
+
+	dims := setType.dims()
+	parts := strings.Split(e.Value, ",")
+	if setType == BitmapIpMac && len(parts) == 1 {
+		// the mac isn't filled yet
+		dims = dims[:1]
+	}
+	if len(dims) == 0 || len(parts) != len(dims) {
+		return fmt.Errorf("want %d components", len(dims))
+	}
+
+	ips := 0
+	for i, dim := range dims {
+		switch dim {
+		case "ip", "net":
+			if ips == 0 {
+				e.IP, e.IPTo, e.CIDR, err = parseIPComponent(parts[i])
+			} else {
+				e.IP2, e.IP2To, e.CIDR2, err = parseIPComponent(parts[i])
+			}
+			ips++
+		case "port":
+			err = e.parsePort(parts[i])
+		case "mac":
+			e.MAC, err = net.ParseMAC(parts[i])
+		case "iface":
+			e.Iface = parts[i]
+			if strings.HasPrefix(e.Iface, "physdev:") {
+				e.Iface, e.Physdev = e.Iface[len("physdev:"):], true
+			}
+		case "mark":
+			var n uint64
+			n, err = strconv.ParseUint(parts[i], 0, 32)
+			e.Mark = uint32(n)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseIPComponent parses ip, ip/cidr or from-to. Host names are
+// left unresolved with a nil ip.
+func parseIPComponent(s string) (ip, to net.IP, cidr int, err error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if ip = net.ParseIP(s); ip != nil {
+		return
+	}
+	if i := strings.LastIndexByte(s, '/'); i != -1 {
+		if cidr, err = strconv.Atoi(s[i+1:]); err != nil {
+			return nil, nil, 0, fmt.Errorf("invalid cidr %q", s[i+1:])
+		}
+		ip = net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(s[:i], "["), "]"))
+		return
+	}
+	if from, end := splitRange(s); end != "" {
+		ip, to = net.ParseIP(from), net.ParseIP(end)
+		if ip == nil || to == nil {
+			ip, to = nil, nil
+		}
+	}
+	return
+}
+
+func (e *Entry) parsePort(s string) (err error) {
+	e.Proto = "tcp"
+	if i := strings.IndexByte(s, ':'); i != -1 && !strings.HasPrefix(s, "[") {
+		e.Proto, s = s[:i], s[i+1:]
+	}
+	if e.Proto == "icmp" || e.Proto == "icmpv6" {
+		e.Port, err = parseICMP(e.Proto, s)
+		return
+	}
+
+	from, to := splitRange(s)
+	if e.Port, err = parsePort(context.Background(), e.Proto, from); err == nil && to != "" {
+		e.PortTo, err = parsePort(context.Background(), e.Proto, to)
+	}
+	return
+}
+
+func (e *Entry) parseExtensions(args []string) error {
+	for i := 0; i < len(args); i++ {
+		if args[i] == _nomatch {
+			e.Nomatch = true
+			continue
+		}
+		if i+1 == len(args) {
+			return fmt.Errorf("missing value of %s", args[i])
+		}
+
+		var (
+			v   = args[i+1]
+			n   uint64
+			err error
+		)
+		switch args[i] {
+		case _timeout:
+			n, err = strconv.ParseUint(v, 10, 32)
+			e.Timeout = time.Duration(n) * time.Second
+		case _packets:
+			n, err = strconv.ParseUint(v, 10, 64)
+			e.Packets = uint(n)
+		case _bytes:
+			n, err = strconv.ParseUint(v, 10, 64)
+			e.Bytes = uint(n)
+		case _comment:
+			e.Comment = v
+		case _skbmark:
+			e.Skbmark = v
+		case _skbprio:
+			e.Skbprio = v
+		case _skbqueue:
+			n, err = strconv.ParseUint(v, 10, 16)
+			e.Skbqueue = uint(n)
+		default:
+			return fmt.Errorf("unknown extension %s", args[i])
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", args[i], v)
+		}
+		i++
+	}
+	return nil
+}
+
+// String returns the entry along with its extensions in the
+// format ipset lists it.
+func (e *Entry) String() string {
+	var b strings.Builder
+	b.WriteString(e.Value)
+	if e.Timeout != 0 {
+		_, _ = fmt.Fprintf(&b, " %s %d", _timeout, e.Timeout/time.Second)
+	}
+	if e.Packets != 0 || e.Bytes != 0 {
+		_, _ = fmt.Fprintf(&b, " %s %d %s %d", _packets, e.Packets, _bytes, e.Bytes)
+	}
+	if e.Comment != "" {
+		_, _ = fmt.Fprintf(&b, ` %s "%s"`, _comment, e.Comment)
+	}
+	if e.Skbmark != "" {
+		_, _ = fmt.Fprintf(&b, " %s %s", _skbmark, e.Skbmark)
+	}
+	if e.Skbprio != "" {
+		_, _ = fmt.Fprintf(&b, " %s %s", _skbprio, e.Skbprio)
+	}
+	if e.Skbqueue != 0 {
+		_, _ = fmt.Fprintf(&b, " %s %d", _skbqueue, e.Skbqueue)
+	}
+	if e.Nomatch {
+		b.WriteString(" " + _nomatch)
+	}
+	return b.String()
+}
+
+// options returns the options of the extensions of the entry.
+func (e *Entry) options() []Option {
+	return []Option{
+		Timeout(e.Timeout),
+		Packets(e.Packets),
+		Bytes(e.Bytes),
+		CommentContent(e.Comment),
+		Skbmark(e.Skbmark),
+		Skbprio(e.Skbprio),
+		Skbqueue(e.Skbqueue),
+		Nomatch(e.Nomatch),
+	}
+}
+
+// key identifies the entry in a set of setType, so that the
+// same entry written in different ways, i.e. 1.1.1.1,80 and
+// 1.1.1.1,tcp:80, has the same key.
+func (e *Entry) key(setType SetType) string {
+	p, err := ParseEntry(setType, e.Value)
+	if err != nil {
+		return e.Value
+	}
+	for _, dim := range setType.dims() {
+		if (dim == "ip" || dim == "net") && p.IP == nil {
+			// host names are compared literally
+			return e.Value
+		}
+	}
+	return fmt.Sprintf("%s-%s/%d,%s-%s/%d,%s:%d-%d,%s,%s,%t,%d,%s",
+		p.IP, p.IPTo, cidr(p.IP, p.CIDR), p.IP2, p.IP2To, cidr(p.IP2, p.CIDR2),
+		p.Proto, p.Port, p.PortTo, p.MAC, p.Iface, p.Physdev, p.Mark, p.Name)
+}
+
+// cidr drops the full length cidr which ipset doesn't list.
+func cidr(ip net.IP, n int) int {
+	if ip.To4() != nil && n == 8*net.IPv4len || ip.To4() == nil && n == 8*net.IPv6len {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+//go:build go1.18
+// +build go1.18
+
+package ipset
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// The entry builders below format typed values as the entries
+// given to Add, Del and Test, which check them against the
+// SetType of the set, i.e.
+//      set.Add(ipset.JoinEntry(
+//          ipset.NetEntry(prefix), ipset.PortEntry("tcp", 80), ipset.IPEntry(addr)))
+// IPv4-mapped IPv6 addresses are unmapped and zones are dropped.
+
+// IPEntry is the entry of hash:ip and bitmap:ip.
+func IPEntry(addr netip.Addr) string {
+	return addrString(addr)
+}
+
+// NetEntry is the entry of hash:net, the host bits of prefix are
+// masked.
+func NetEntry(prefix netip.Prefix) string {
+	return netString(prefix)
+}
+
+// RangeEntry is the from-to range of an ip or net component.
+func RangeEntry(from, to netip.Addr) string {
+	return addrString(from) + "-" + addrString(to)
+}
+
+// PortEntry is the [proto:]port component, i.e. the entry of
+// bitmap:port. For icmp and icmpv6, port holds the type in the
+// high byte and the code in the low byte.
+func PortEntry(proto string, port uint16) string {
+	switch proto {
+	case "":
+		return fmt.Sprintf("%d", port)
+	case "icmp", "icmpv6":
+		return fmt.Sprintf("%s:%d/%d", proto, port>>8, port&0xff)
+	}
+	return fmt.Sprintf("%s:%d", proto, port)
+}
+
+// MacEntry is the entry of hash:mac.
+func MacEntry(mac net.HardwareAddr) string {
+	return mac.String()
+}
+
+// IPPortEntry is the entry of hash:ip,port.
+func IPPortEntry(addr netip.Addr, proto string, port uint16) string {
+	return JoinEntry(IPEntry(addr), PortEntry(proto, port))
+}
+
+// IPMacEntry is the entry of hash:ip,mac and bitmap:ip,mac.
+func IPMacEntry(addr netip.Addr, mac net.HardwareAddr) string {
+	return JoinEntry(IPEntry(addr), MacEntry(mac))
+}
+
+// IPMarkEntry is the entry of hash:ip,mark.
+func IPMarkEntry(addr netip.Addr, mark uint32) string {
+	return JoinEntry(IPEntry(addr), fmt.Sprintf("0x%08x", mark))
+}
+
+// NetIfaceEntry is the entry of hash:net,iface, physdev prefixes
+// the iface with physdev: to match the bridge port.
+func NetIfaceEntry(prefix netip.Prefix, iface string, physdev bool) string {
+	if physdev {
+		iface = "physdev:" + iface
+	}
+	return JoinEntry(NetEntry(prefix), iface)
+}
+
+// JoinEntry joins the components of a multiple dimension entry,
+// i.e. hash:net,port,net.
+func JoinEntry(components ...string) string {
+	return strings.Join(components, ",")
+}
+
+func addrString(addr netip.Addr) string {
+	return addr.Unmap().WithZone("").String()
+}
+
+func netString(prefix netip.Prefix) string {
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		addr, bits = addr.Unmap(), bits-96
+	}
+	p, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return prefix.String()
+	}
+	return p.String()
+}
@@ -0,0 +1,65 @@
+//go:build go1.18
+// +build go1.18
+
+package ipset
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EntryBuilders(t *testing.T) {
+	t.Parallel()
+
+	addr := netip.MustParseAddr("192.168.0.1")
+	addr6 := netip.MustParseAddr("fe80::1%eth0")
+	prefix := netip.MustParsePrefix("10.1.2.3/8")
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+
+	cases := []struct {
+		setType SetType
+		entry   string
+		want    string
+	}{
+		{HashIp, IPEntry(addr), "192.168.0.1"},
+		{HashIp, IPEntry(netip.MustParseAddr("::ffff:1.1.1.1")), "1.1.1.1"},
+		{HashIp, IPEntry(addr6), "fe80::1"},
+		{HashNet, NetEntry(prefix), "10.0.0.0/8"},
+		{HashNet, NetEntry(netip.MustParsePrefix("::ffff:10.0.0.0/104")), "10.0.0.0/8"},
+		{HashNet, RangeEntry(addr, addr.Next()), "192.168.0.1-192.168.0.2"},
+		{BitmapPort, PortEntry("", 80), "80"},
+		{HashMac, MacEntry(mac), "00:11:22:33:44:55"},
+		{HashIpPort, IPPortEntry(addr, "udp", 53), "192.168.0.1,udp:53"},
+		{HashIpPort, IPPortEntry(addr, "icmp", 8<<8), "192.168.0.1,icmp:8/0"},
+		{HashIpMac, IPMacEntry(addr, mac), "192.168.0.1,00:11:22:33:44:55"},
+		{HashIpMark, IPMarkEntry(addr, 16), "192.168.0.1,0x00000010"},
+		{HashNetIface, NetIfaceEntry(prefix, "eth0", false), "10.0.0.0/8,eth0"},
+		{HashNetIface, NetIfaceEntry(prefix, "br0", true), "10.0.0.0/8,physdev:br0"},
+		{HashNetPortNet, JoinEntry(NetEntry(prefix), PortEntry("tcp", 80), NetEntry(prefix)), "10.0.0.0/8,tcp:80,10.0.0.0/8"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, c.entry)
+		assert.Nil(t, c.setType.ValidateEntry(c.entry, nil), c.entry)
+	}
+}
+
+func Test_EntryBuilders_Set(t *testing.T) {
+	t.Parallel()
+
+	b := &fakeBackend{}
+	s, err := NewClient(b).New("foo", HashIpPort)
+	require.Nil(t, err)
+
+	require.Nil(t, s.Add(IPPortEntry(netip.MustParseAddr("1.1.1.1"), "tcp", 80)))
+	assert.Equal(t, []string{_add, "foo", "1.1.1.1,tcp:80"}, b.args[1])
+
+	err = s.Add(IPEntry(netip.MustParseAddr("1.1.1.1")))
+	assert.True(t, errors.Is(err, ErrInvalidEntry))
+	err = s.Add(IPPortEntry(netip.Addr{}, "tcp", 80))
+	assert.True(t, errors.Is(err, ErrInvalidEntry))
+}
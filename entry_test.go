@@ -0,0 +1,91 @@
+package ipset
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseEntry(t *testing.T) {
+	t.Parallel()
+
+	t.Run("components", func(t *testing.T) {
+		tt := []struct {
+			setType SetType
+			s       string
+			want    Entry
+		}{
+			{HashIp, "1.1.1.1", Entry{IP: net.ParseIP("1.1.1.1")}},
+			{HashIp, "one.one.one.one", Entry{}},
+			{BitmapIp, "192.168.0.1-192.168.0.9", Entry{IP: net.ParseIP("192.168.0.1"), IPTo: net.ParseIP("192.168.0.9")}},
+			{HashNet, "2001:db8::/32", Entry{IP: net.ParseIP("2001:db8::"), CIDR: 32}},
+			{HashNetNet, "10.0.0.0/8,192.168.0.0/16", Entry{
+				IP: net.ParseIP("10.0.0.0"), CIDR: 8, IP2: net.ParseIP("192.168.0.0"), CIDR2: 16}},
+			{HashIpPortIp, "1.1.1.1,udp:53,2.2.2.2", Entry{
+				IP: net.ParseIP("1.1.1.1"), Proto: "udp", Port: 53, IP2: net.ParseIP("2.2.2.2")}},
+			{HashIpPort, "1.1.1.1,icmp:8/0", Entry{IP: net.ParseIP("1.1.1.1"), Proto: "icmp", Port: 8 << 8}},
+			{HashIpPort, "1.1.1.1,icmp:echo-request", Entry{IP: net.ParseIP("1.1.1.1"), Proto: "icmp", Port: 8 << 8}},
+			{HashIpPort, "::1,icmpv6:echo-reply", Entry{IP: net.ParseIP("::1"), Proto: "icmpv6", Port: 129 << 8}},
+			{BitmapPort, "80-88", Entry{Proto: "tcp", Port: 80, PortTo: 88}},
+			{BitmapIpMac, "192.168.0.1", Entry{IP: net.ParseIP("192.168.0.1")}},
+			{HashMac, "01:02:03:04:05:06", Entry{MAC: net.HardwareAddr{1, 2, 3, 4, 5, 6}}},
+			{HashNetIface, "10.0.0.0/8,physdev:eth0", Entry{
+				IP: net.ParseIP("10.0.0.0"), CIDR: 8, Iface: "eth0", Physdev: true}},
+			{HashIpMark, "1.1.1.1,0x00000010", Entry{IP: net.ParseIP("1.1.1.1"), Mark: 16}},
+			{ListSet, "foo", Entry{Name: "foo"}},
+		}
+
+		for _, tc := range tt {
+			e, err := ParseEntry(tc.setType, tc.s)
+			require.Nil(t, err, tc.s)
+			tc.want.Value = tc.s
+			assert.Equal(t, tc.want, *e, tc.s)
+		}
+	})
+
+	t.Run("extensions", func(t *testing.T) {
+		s := `1.1.1.1 timeout 3599 packets 1 bytes 2 comment "a b" skbmark 0x1111/0xff00ffff skbprio 1:10 skbqueue 10 nomatch`
+		e, err := ParseEntry(HashIp, s)
+		require.Nil(t, err)
+		assert.Equal(t, 3599*time.Second, e.Timeout)
+		assert.Equal(t, uint(1), e.Packets)
+		assert.Equal(t, uint(2), e.Bytes)
+		assert.Equal(t, "a b", e.Comment)
+		assert.Equal(t, "0x1111/0xff00ffff", e.Skbmark)
+		assert.Equal(t, "1:10", e.Skbprio)
+		assert.Equal(t, uint(10), e.Skbqueue)
+		assert.True(t, e.Nomatch)
+		assert.Equal(t, s, e.String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, s := range []string{
+			"", "1.1.1.1,80", "10.0.0.0/x", "1.1.1.1 timeout",
+			"1.1.1.1 timeout x", "1.1.1.1 unknown 1", `1.1.1.1 comment "x`,
+		} {
+			_, err := ParseEntry(HashIp, s)
+			assert.Error(t, err, s)
+		}
+		_, err := ParseEntry(HashMac, "xx:yy")
+		assert.Error(t, err)
+		_, err = ParseEntry(HashIpPort, "1.1.1.1,icmp:unknown")
+		assert.Error(t, err)
+	})
+}
+
+func Test_Entry_Key(t *testing.T) {
+	t.Parallel()
+
+	key := func(setType SetType, s string) string {
+		return (&Entry{Value: s}).key(setType)
+	}
+	assert.Equal(t, key(HashNet, "10.0.0.1"), key(HashNet, "10.0.0.1/32"))
+	assert.Equal(t, key(HashIpPort, "1.1.1.1,tcp:80"), key(HashIpPort, "1.1.1.1,80"))
+	assert.Equal(t, key(HashIpMark, "1.1.1.1,0x10"), key(HashIpMark, "1.1.1.1,16"))
+	assert.Equal(t, key(HashMac, "01:02:03:04:05:06"), key(HashMac, "01:02:03:04:05:06"))
+	assert.NotEqual(t, key(HashNet, "10.0.0.0/8"), key(HashNet, "10.0.0.0/16"))
+	assert.NotEqual(t, key(HashIp, "one.one.one.one"), key(HashIp, "two.two.two.two"))
+}
@@ -0,0 +1,122 @@
+package ipset
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+)
+
+// Errors classified from the output of a failed ipset command.
+// They are wrapped by *OpError, so use errors.Is to check them.
+var (
+	// ErrSetNotExist is returned if the set with the given name does not exist
+	ErrSetNotExist = errors.New("set does not exist")
+	// ErrSetExists is returned if a set with the same name already exists
+	ErrSetExists = errors.New("set already exists")
+	// ErrEntryExists is returned if the entry is already added to the set
+	ErrEntryExists = errors.New("entry already added")
+	// ErrEntryNotExist is returned if the entry is not added to the set
+	ErrEntryNotExist = errors.New("entry not added")
+	// ErrSetInUse is returned if the set is referenced by a kernel component
+	ErrSetInUse = errors.New("set is in use")
+	// ErrSetFull is returned if no more entries can be added to the set
+	ErrSetFull = errors.New("set is full")
+	// ErrTypeIncompatible is returned if the types of the sets do not match
+	ErrTypeIncompatible = errors.New("set type is incompatible")
+	// ErrKernelModuleMissing is returned if kernel doesn't support ipset or the set type
+	ErrKernelModuleMissing = errors.New("kernel module is missing")
+	// ErrPermission is returned if the operation is not permitted
+	ErrPermission = errors.New("operation not permitted")
+)
+
+// errPatterns maps the messages of ipset, which are lowercased,
+// to the errors. The first matched one wins.
+var errPatterns = []struct {
+	pattern []byte
+	err     error
+}{
+	{[]byte("set with the same name already exists"), ErrSetExists},
+	{[]byte("does not exist"), ErrSetNotExist},
+	{[]byte("it's already added"), ErrEntryExists},
+	{[]byte("it's not added"), ErrEntryNotExist},
+	{[]byte("in use by a kernel component"), ErrSetInUse},
+	{[]byte("is full"), ErrSetFull},
+	{[]byte("type does not match"), ErrTypeIncompatible},
+	{[]byte("set type not supported"), ErrKernelModuleMissing},
+	{[]byte("cannot open session to kernel"), ErrKernelModuleMissing},
+	{[]byte("protocol not supported"), ErrKernelModuleMissing},
+	{[]byte("operation not permitted"), ErrPermission},
+	{[]byte("permission denied"), ErrPermission},
+}
+
+func classify(out []byte) error {
+	out = bytes.ToLower(out)
+	for _, p := range errPatterns {
+		if bytes.Contains(out, p.pattern) {
+			return p.err
+		}
+	}
+	return nil
+}
+
+// OpError is the error returned by a failed ipset command.
+type OpError struct {
+	// Action is the ipset command, i.e. add.
+	Action string
+	// Set is the name of the set if any.
+	Set string
+	// Entry is the entry of add, del and test.
+	Entry string
+	// Args are the command line arguments run by the Backend.
+	Args []string
+	// Output is the raw output of the command.
+	Output string
+	// Err is one of the errors above classified from Output, the
+	// error of context if it is done, or the error returned by
+	// the Backend.
+	Err error
+
+	op string
+}
+
+func (e *OpError) Error() string {
+	if e.Output != "" || e.Err == nil {
+		return "ipset: can't " + e.op + ": " + e.Output
+	}
+	return "ipset: can't " + e.op + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// run runs args by b and returns an *OpError which describes the
+// failed op, i.e. "flush set foo".
+func run(ctx context.Context, b Backend, op string, stdin []byte, args ...string) ([]byte, error) {
+	out, err := b.Run(ctx, stdin, args...)
+	if err == nil {
+		return out, nil
+	}
+
+	e := &OpError{Args: args, op: op}
+	if len(args) > 0 {
+		e.Action = args[0]
+	}
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		e.Set = args[1]
+	}
+	if len(args) > 2 && (e.Action == _add || e.Action == _del || e.Action == _test) {
+		e.Entry = args[2]
+	}
+
+	if ctx.Err() != nil {
+		e.Err = ctx.Err()
+		return out, e
+	}
+	e.Output = string(out)
+	if e.Err = classify(out); e.Err == nil {
+		e.Err = err
+	}
+	return out, e
+}
@@ -0,0 +1,80 @@
+package ipset
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Classify(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		out string
+		err error
+	}{
+		{"ipset v7.1: The set with the given name does not exist", ErrSetNotExist},
+		{"ipset v7.1: Set cannot be created: set with the same name already exists", ErrSetExists},
+		{"ipset v7.1: Element cannot be added to the set: it's already added", ErrEntryExists},
+		{"ipset v7.1: Element cannot be deleted from the set: it's not added", ErrEntryNotExist},
+		{"ipset v7.1: Set cannot be destroyed: it is in use by a kernel component", ErrSetInUse},
+		{"ipset v7.1: Hash is full, cannot add more elements", ErrSetFull},
+		{"ipset v7.1: The sets cannot be swapped: their type does not match", ErrTypeIncompatible},
+		{"ipset v7.1: Kernel error received: set type not supported", ErrKernelModuleMissing},
+		{"ipset v7.1: Cannot open session to kernel.", ErrKernelModuleMissing},
+		{"ipset v7.1: Kernel error received: Operation not permitted", ErrPermission},
+		{"Cannot open netlink socket: permission denied", ErrPermission},
+		{"ipset v7.1: Syntax error: unknown argument", nil},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.err, classify([]byte(tc.out)), tc.out)
+	}
+}
+
+func Test_OpError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("classified", func(t *testing.T) {
+		out := "ipset v7.1: Element cannot be added to the set: it's already added\n"
+		err := NewClient(&fakeBackend{out: out, err: errors.New("exit status 1")}).
+			Flush("foo")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrEntryExists))
+
+		s := &set{"foo", HashIp, NewClient(&fakeBackend{out: out, err: errors.New("exit status 1")}), nil}
+		err = s.Add("1.1.1.1", Timeout(time.Minute))
+		var e *OpError
+		require.True(t, errors.As(err, &e))
+		assert.Equal(t, _add, e.Action)
+		assert.Equal(t, "foo", e.Set)
+		assert.Equal(t, "1.1.1.1", e.Entry)
+		assert.Equal(t, []string{_add, "foo", "1.1.1.1", _timeout, "60"}, e.Args)
+		assert.Equal(t, out, e.Output)
+		assert.Equal(t, "ipset: can't add foo 1.1.1.1: "+out, e.Error())
+	})
+
+	t.Run("unclassified", func(t *testing.T) {
+		exit := errors.New("exit status 1")
+		err := NewClient(&fakeBackend{err: exit}).Destroy()
+		assert.True(t, errors.Is(err, exit))
+		assert.Equal(t, "ipset: can't destroy all set: exit status 1", err.Error())
+
+		var e *OpError
+		require.True(t, errors.As(err, &e))
+		assert.Equal(t, _destroy, e.Action)
+		assert.Equal(t, "", e.Set)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := NewClient(&fakeBackend{}).SwapContext(ctx, "a", "b")
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, "ipset: can't swap from a to b: context canceled", err.Error())
+	})
+}
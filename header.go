@@ -0,0 +1,175 @@
+package ipset
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetHeader holds the parsed header data of a set, i.e. the
+// create options it is created with and its number of entries.
+type SetHeader struct {
+	Family     NetFamily
+	HashSize   uint
+	MaxElem    uint
+	Bucketsize uint
+	Initval    uint32
+	Timeout    time.Duration
+	Netmask    byte
+	// Bitmask is the address mask of hash:ip, hash:ip,port and
+	// hash:net,net.
+	Bitmask  string
+	Markmask uint32
+	// Range is the ip range of bitmap:ip and bitmap:ip,mac or
+	// the port range of bitmap:port.
+	Range string
+	// Size is the size of list:set.
+	Size     uint
+	Counters bool
+	Comment  bool
+	Skbinfo  bool
+	Forceadd bool
+
+	// Entries is the number of entries in the set. It may be
+	// larger than the number of listed entries for sets with
+	// the timeout extension, see Timeout.
+	Entries int
+}
+
+// ParseHeader parses the header line listed by ipset, i.e.
+//      family inet hashsize 1024 maxelem 65536 timeout 10800
+// Unknown parameters of newer ipset versions are skipped.
+func ParseHeader(s string) (*SetHeader, error) {
+	h := &SetHeader{}
+	args := strings.Fields(s)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case _counters:
+			h.Counters = true
+			continue
+		case _comment:
+			h.Comment = true
+			continue
+		case _skbinfo:
+			h.Skbinfo = true
+			continue
+		case _forceadd:
+			h.Forceadd = true
+			continue
+		case _family, _hashsize, _maxelem, _bucketsize, _initval,
+			_timeout, _netmask, _bitmask, _markmask, _range, _size:
+		default:
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, fmt.Errorf("ipset: can't parse header %q: missing value of %s", s, args[i])
+		}
+
+		var (
+			v   = args[i+1]
+			n   uint64
+			err error
+		)
+		switch args[i] {
+		case _family:
+			h.Family = NetFamily(v)
+		case _hashsize:
+			n, err = strconv.ParseUint(v, 10, 32)
+			h.HashSize = uint(n)
+		case _maxelem:
+			n, err = strconv.ParseUint(v, 10, 32)
+			h.MaxElem = uint(n)
+		case _bucketsize:
+			n, err = strconv.ParseUint(v, 10, 8)
+			h.Bucketsize = uint(n)
+		case _initval:
+			n, err = strconv.ParseUint(v, 0, 32)
+			h.Initval = uint32(n)
+		case _timeout:
+			n, err = strconv.ParseUint(v, 10, 32)
+			h.Timeout = time.Duration(n) * time.Second
+		case _netmask:
+			n, err = strconv.ParseUint(v, 10, 8)
+			h.Netmask = byte(n)
+		case _bitmask:
+			h.Bitmask = v
+		case _markmask:
+			n, err = strconv.ParseUint(v, 0, 32)
+			h.Markmask = uint32(n)
+		case _range:
+			h.Range = v
+		case _size:
+			n, err = strconv.ParseUint(v, 10, 32)
+			h.Size = uint(n)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ipset: can't parse header %q: invalid %s %q", s, args[i], v)
+		}
+		i++
+	}
+	return h, nil
+}
+
+// Options returns the create options of the header, so that a
+// set is created with the same header by them. Only the options
+// set in the header are returned, which are the ones valid for
+// the type of the set listing it.
+func (h *SetHeader) Options() []Option {
+	opts := []Option{
+		Timeout(h.Timeout),
+		Counters(h.Counters),
+		Comment(h.Comment),
+		Skbinfo(h.Skbinfo),
+		Forceadd(h.Forceadd),
+		HashSize(h.HashSize),
+		MaxElem(h.MaxElem),
+		Bucketsize(h.Bucketsize),
+		Initval(h.Initval),
+		Netmask(h.Netmask),
+		Bitmask(h.Bitmask),
+		ListSize(h.Size),
+	}
+	if h.Markmask != 0 {
+		opts = append(opts, Markmask(h.Markmask))
+	}
+	if h.Family != "" {
+		opts = append(opts, Family(h.Family))
+	}
+	// the port range of bitmap:port has neither dots nor cidr
+	if strings.ContainsAny(h.Range, "./") {
+		opts = append(opts, IpRange(h.Range))
+	} else if h.Range != "" {
+		opts = append(opts, PortRange(h.Range))
+	}
+	return opts
+}
+
+// createHeader returns the header of a set created with options,
+// the parameters not given are left to the defaults of ipset.
+func createHeader(setType SetType, options ...Option) *SetHeader {
+	o := acquireOptions().apply(options...)
+	defer releaseOptions(o)
+
+	h := &SetHeader{
+		Family:     o.family,
+		HashSize:   o.hashSize,
+		MaxElem:    o.maxElem,
+		Bucketsize: o.bucketsize,
+		Initval:    o.initval,
+		Timeout:    o.timeout,
+		Netmask:    o.netmask,
+		Bitmask:    o.bitmask,
+		Markmask:   o.markmask,
+		Range:      o.ipRange,
+		Size:       o.listSize,
+		Counters:   o.counters,
+		Comment:    o.comment,
+		Skbinfo:    o.skbinfo,
+		Forceadd:   o.forceadd,
+	}
+	if setType == BitmapPort {
+		h.Range = o.portRange
+	}
+	return h
+}
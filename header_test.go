@@ -0,0 +1,107 @@
+package ipset
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseHeader(t *testing.T) {
+	t.Parallel()
+
+	t.Run("hash", func(t *testing.T) {
+		h, err := ParseHeader("family inet6 hashsize 1024 maxelem 65536 netmask 64 bucketsize 12 initval 0x5ad1a5b2 timeout 10800 counters comment skbinfo forceadd")
+		require.Nil(t, err)
+		assert.Equal(t, SetHeader{
+			Family:     Inet6,
+			HashSize:   1024,
+			MaxElem:    65536,
+			Netmask:    64,
+			Bucketsize: 12,
+			Initval:    0x5ad1a5b2,
+			Timeout:    10800 * time.Second,
+			Counters:   true,
+			Comment:    true,
+			Skbinfo:    true,
+			Forceadd:   true,
+		}, *h)
+	})
+
+	t.Run("bitmap and list", func(t *testing.T) {
+		h, err := ParseHeader("range 192.168.0.0-192.168.255.255 netmask 24")
+		require.Nil(t, err)
+		assert.Equal(t, "192.168.0.0-192.168.255.255", h.Range)
+		assert.Equal(t, byte(24), h.Netmask)
+
+		h, err = ParseHeader("size 8 unknown")
+		require.Nil(t, err)
+		assert.Equal(t, uint(8), h.Size)
+
+		h, err = ParseHeader("family inet hashsize 1024 maxelem 65536 bitmask 255.255.0.0")
+		require.Nil(t, err)
+		assert.Equal(t, "255.255.0.0", h.Bitmask)
+
+		h, err = ParseHeader("family inet markmask 0x0000ffff")
+		require.Nil(t, err)
+		assert.Equal(t, uint32(0xffff), h.Markmask)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, s := range []string{"hashsize", "maxelem x", "netmask 256", "timeout -1"} {
+			_, err := ParseHeader(s)
+			assert.Error(t, err, s)
+		}
+	})
+}
+
+func Test_SetHeader_Options(t *testing.T) {
+	t.Parallel()
+
+	h := &SetHeader{Family: Inet6, HashSize: 1024, MaxElem: 65536, Timeout: time.Minute, Counters: true, Forceadd: true}
+	c := getCmd(_create, "foo", HashIp, string(HashIp))
+	defer putCmd(c)
+	assert.Equal(t, []string{_create, "foo", string(HashIp), _timeout, "60", _counters, _forceadd,
+		_family, string(Inet6), _hashsize, "1024", _maxelem, "65536"}, c.buildArgs(h.Options()...))
+
+	h = &SetHeader{Bucketsize: 4, Initval: 0x5ad1a5b2, Bitmask: "255.255.0.0"}
+	c = getCmd(_create, "foo", HashIp, string(HashIp))
+	defer putCmd(c)
+	assert.Equal(t, []string{_create, "foo", string(HashIp), _bucketsize, "4", _initval, "0x5ad1a5b2",
+		_bitmask, "255.255.0.0"}, c.buildArgs(h.Options()...))
+
+	h = &SetHeader{Range: "80-88"}
+	c = getCmd(_create, "bar", BitmapPort, string(BitmapPort))
+	defer putCmd(c)
+	assert.Equal(t, []string{_create, "bar", string(BitmapPort), _range, "80-88"}, c.buildArgs(h.Options()...))
+}
+
+func Test_SetHeader_Recreate(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient(newFakeKernel().backend())
+	for _, tc := range []struct {
+		setType SetType
+		options []Option
+	}{
+		{HashIp, []Option{Timeout(time.Minute), Netmask(24), Comment(true)}},
+		{HashIpMark, []Option{Markmask(0xffff), Family(Inet6)}},
+		{HashMac, []Option{Counters(true)}},
+		{BitmapIp, []Option{IpRange("192.168.0.0-192.168.255.255"), Netmask(24)}},
+		{BitmapPort, []Option{PortRange("80-88")}},
+		{ListSet, []Option{ListSize(4)}},
+	} {
+		s, err := c.New("foo", tc.setType, tc.options...)
+		require.Nil(t, err, tc.setType)
+		info, err := s.List()
+		require.Nil(t, err, tc.setType)
+
+		bar, err := c.New("bar", info.SetType, append(info.SetHeader.Options(), Strict(true))...)
+		require.Nil(t, err, tc.setType)
+		barInfo, err := bar.List()
+		require.Nil(t, err, tc.setType)
+		assert.Equal(t, info.Header, barInfo.Header, tc.setType)
+		require.Nil(t, c.Destroy("foo", "bar"))
+	}
+}
@@ -17,12 +17,12 @@
 package ipset
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"io"
 	"os/exec"
 	"regexp"
+	"strconv"
 )
 
 // Version of current package
@@ -31,16 +31,18 @@ const Version = "0.1.0"
 const minMajorVersion = 6
 
 var (
-	ipsetPath string
 	// ErrNotFound is returned if there is no ipset found in os path
 	ErrNotFound = errors.New("ipset utility not found")
 	// ErrVersionNotSupported is returned if ipset's version is not bigger than v6.0
 	ErrVersionNotSupported = errors.New("ipset utility version is not supported, requiring version >= 6.0")
+	// ErrOptionNotSupported is returned if an option requires a
+	// newer version of the ipset utility in use.
+	ErrOptionNotSupported = errors.New("option is not supported by ipset")
 )
 
 var (
-	execCommand  = exec.Command
-	execLookPath = exec.LookPath
+	execCommandContext = exec.CommandContext
+	execLookPath       = exec.LookPath
 )
 
 // IPSet is abstract of ipset
@@ -50,51 +52,149 @@ type IPSet interface {
 	// action lookups(which may be slow).
 	List(options ...Option) (*Info, error)
 
+	// ListContext is like List but aborts as soon as ctx is done.
+	ListContext(ctx context.Context, options ...Option) (*Info, error)
+
 	// List dumps header data and the entries for the set to the
 	// specific file. The Resolve option can be used to force
 	// action lookups(which may be slow).
 	ListToFile(filename string, options ...Option) error
 
+	// ListToFileContext is like ListToFile but aborts as soon as
+	// ctx is done.
+	ListToFileContext(ctx context.Context, filename string, options ...Option) error
+
 	// Name returns the set's name
 	Name() string
 
 	// Rename the set's action and the new action must not exist.
 	Rename(newName string) error
 
+	// RenameContext is like Rename but aborts as soon as ctx is done.
+	RenameContext(ctx context.Context, newName string) error
+
 	// Add adds a given entry to the set. If the Exist option is
 	// specified, ipset ignores the error if the entry already
 	// added to the set.
 	Add(entry string, options ...Option) error
 
+	// AddContext is like Add but aborts as soon as ctx is done.
+	AddContext(ctx context.Context, entry string, options ...Option) error
+
 	// Del deletes an entry from a set. If the Exist option is
 	// specified and the entry is not in the set (maybe already
 	// expired), then the command ignores the error.
 	Del(entry string, options ...Option) error
 
-	// Test tests whether an entry is in a set or not.
-	Test(entry string) (bool, error)
+	// DelContext is like Del but aborts as soon as ctx is done.
+	DelContext(ctx context.Context, entry string, options ...Option) error
+
+	// AddMany adds entries to the set by one restore session
+	// rather than one command per entry, options are applied to
+	// every entry. If some of the entries fail, the others are
+	// added anyway and a *BatchError is returned.
+	AddMany(entries []string, options ...Option) error
+
+	// AddManyContext is like AddMany but aborts as soon as ctx is
+	// done.
+	AddManyContext(ctx context.Context, entries []string, options ...Option) error
+
+	// DelMany deletes entries from the set the same way as
+	// AddMany.
+	DelMany(entries []string, options ...Option) error
+
+	// DelManyContext is like DelMany but aborts as soon as ctx is
+	// done.
+	DelManyContext(ctx context.Context, entries []string, options ...Option) error
+
+	// Replace replaces all entries of the set with the given ones
+	// atomically. A temporary set with the same type and header is
+	// created and loaded with entries, then it's swapped with the
+	// set and destroyed, so the set is never seen half filled.
+	Replace(entries []string, options ...Option) error
+
+	// ReplaceContext is like Replace but aborts as soon as ctx is
+	// done.
+	ReplaceContext(ctx context.Context, entries []string, options ...Option) error
+
+	// Sync converges the set to the desired entries. The current
+	// entries are listed and diffed with desired ones, then only
+	// the added, removed and updated entries are applied by one
+	// restore session. A *BatchError is returned along with the
+	// report if some of them fail.
+	Sync(desired []Entry) (*SyncReport, error)
+
+	// SyncContext is like Sync but aborts as soon as ctx is done.
+	SyncContext(ctx context.Context, desired []Entry) (*SyncReport, error)
+
+	// Test tests whether an entry is in a set or not. The
+	// Nomatch option must be specified to test the entries added
+	// with the nomatch flag to hash:*net* sets, which are not
+	// matched otherwise.
+	Test(entry string, options ...Option) (bool, error)
+
+	// TestContext is like Test but aborts as soon as ctx is done.
+	TestContext(ctx context.Context, entry string, options ...Option) (bool, error)
+
+	// TestMany tests entries by restore sessions rather than one
+	// command per entry and returns whether each of them is in the
+	// set, options are applied to every entry. If some of the
+	// entries fail for other reasons, they are reported as not in
+	// the set and a *BatchError is returned along with the results.
+	//
+	// The netlink backend tests all entries in one pass. Since
+	// ipset restore stops at the first entry not in the set, the
+	// ipset utility is run once more for each such entry, so it
+	// costs about as much as Test when most entries are missing.
+	TestMany(entries []string, options ...Option) (map[string]bool, error)
+
+	// TestManyContext is like TestMany but aborts as soon as ctx
+	// is done.
+	TestManyContext(ctx context.Context, entries []string, options ...Option) (map[string]bool, error)
 
 	// Flush flushed all entries from the the set.
 	Flush() error
 
+	// FlushContext is like Flush but aborts as soon as ctx is done.
+	FlushContext(ctx context.Context) error
+
 	// Destroy removes the set from kernel.
 	Destroy() error
 
+	// DestroyContext is like Destroy but aborts as soon as ctx is
+	// done.
+	DestroyContext(ctx context.Context) error
+
 	// Save dumps the set data to a io.Reader in a format that restore
 	// can read.
 	Save(options ...Option) (io.Reader, error)
 
+	// SaveContext is like Save but aborts as soon as ctx is done.
+	SaveContext(ctx context.Context, options ...Option) (io.Reader, error)
+
 	// SaveToFile dumps the set data to s specific file in a format
 	// that restore can read.
 	SaveToFile(filename string, options ...Option) error
 
+	// SaveToFileContext is like SaveToFile but aborts as soon as
+	// ctx is done.
+	SaveToFileContext(ctx context.Context, filename string, options ...Option) error
+
 	// Restore restores a saved session from io.Reader generated by
 	// save. Set exist to true to ignore exist error.
 	Restore(r io.Reader, exist ...bool) error
 
+	// RestoreContext is like Restore but aborts as soon as ctx is
+	// done.
+	RestoreContext(ctx context.Context, r io.Reader, exist ...bool) error
+
 	// RestoreFromFile restores a saved session from a specific file
 	// generated by save. Set exist to true to ignore exist error.
 	RestoreFromFile(filename string, exist ...bool) error
+
+	// RestoreFromFileContext is like RestoreFromFile but aborts as
+	// soon as ctx is done.
+	RestoreFromFileContext(ctx context.Context, filename string, exist ...bool) error
 }
 
 // New create a set identified with setname and specified type.
@@ -102,138 +202,201 @@ type IPSet interface {
 // option is specified, ipset ignores the error when the same set
 // (setname and create parameters are identical) already exists.
 func New(name string, setType SetType, options ...Option) (IPSet, error) {
-	c := getCmd(_create, name, setType, string(setType))
-	defer putCmd(c)
-	if err := c.exec(options...); err != nil {
-		return nil, err
-	}
-	return &set{name, setType}, nil
+	return std.New(name, setType, options...)
+}
+
+// NewContext is like New but aborts as soon as ctx is done.
+func NewContext(ctx context.Context, name string, setType SetType, options ...Option) (IPSet, error) {
+	return std.NewContext(ctx, name, setType, options...)
+}
+
+// Open returns the existing set identified with setname, its type
+// is discovered from kernel. If there is no such set, an error
+// wrapping ErrSetNotExist is returned.
+func Open(name string) (IPSet, error) {
+	return std.Open(name)
+}
+
+// OpenContext is like Open but aborts as soon as ctx is done.
+func OpenContext(ctx context.Context, name string) (IPSet, error) {
+	return std.OpenContext(ctx, name)
+}
+
+// ListAll dumps header data and the entries of all sets selected
+// by filters, i.e. TypeFilter and PrefixFilter.
+func ListAll(filters ...Filter) ([]*Info, error) {
+	return std.ListAll(filters...)
+}
+
+// ListAllContext is like ListAll but aborts as soon as ctx is done.
+func ListAllContext(ctx context.Context, filters ...Filter) ([]*Info, error) {
+	return std.ListAllContext(ctx, filters...)
+}
+
+// ListNames lists the names of all sets selected by filters.
+func ListNames(filters ...Filter) ([]string, error) {
+	return std.ListNames(filters...)
+}
+
+// ListNamesContext is like ListNames but aborts as soon as ctx is
+// done.
+func ListNamesContext(ctx context.Context, filters ...Filter) ([]string, error) {
+	return std.ListNamesContext(ctx, filters...)
+}
+
+// Apply converges the sets on the host to cfg, see Config.
+func Apply(cfg *Config) error {
+	return std.Apply(cfg)
+}
+
+// ApplyContext is like Apply but aborts as soon as ctx is done.
+func ApplyContext(ctx context.Context, cfg *Config) error {
+	return std.ApplyContext(ctx, cfg)
+}
+
+// RestoreAll restores the save file read from r, which may create
+// and fill any number of sets. The input is validated before it's
+// run by one restore session, and if ipset fails at a line, a
+// *RestoreError reports the line number of the input.
+func RestoreAll(r io.Reader, options ...Option) error {
+	return std.RestoreAll(r, options...)
+}
+
+// RestoreAllContext is like RestoreAll but aborts as soon as ctx
+// is done.
+func RestoreAllContext(ctx context.Context, r io.Reader, options ...Option) error {
+	return std.RestoreAllContext(ctx, r, options...)
+}
+
+// SaveAll writes all sets in the format of ipset save to w.
+func SaveAll(w io.Writer) error {
+	return std.SaveAll(w)
+}
+
+// SaveAllContext is like SaveAll but aborts as soon as ctx is done.
+func SaveAllContext(ctx context.Context, w io.Writer) error {
+	return std.SaveAllContext(ctx, w)
+}
+
+// TakeSnapshot saves the state of all sets, which is restored by
+// Rollback, i.e. around a risky change of several sets.
+func TakeSnapshot() (*Snapshot, error) {
+	return std.TakeSnapshot()
+}
+
+// TakeSnapshotContext is like TakeSnapshot but aborts as soon as
+// ctx is done.
+func TakeSnapshotContext(ctx context.Context) (*Snapshot, error) {
+	return std.TakeSnapshotContext(ctx)
+}
+
+// Rollback restores the exact state of snap: the sets removed
+// since are recreated, the changed ones are rebuilt and the sets
+// created since are destroyed.
+func Rollback(snap *Snapshot) error {
+	return std.Rollback(snap)
+}
+
+// RollbackContext is like Rollback but aborts as soon as ctx is
+// done.
+func RollbackContext(ctx context.Context, snap *Snapshot) error {
+	return std.RollbackContext(ctx, snap)
+}
+
+// Begin starts a Tx which queues operations across sets and
+// submits them by one restore session on Commit.
+func Begin() *Tx {
+	return std.Begin()
 }
 
 // Flush all entries from the specified set or flush all sets if none
 // is given.
 func Flush(names ...string) error {
-	if len(names) > 0 {
-		for _, name := range names {
-			if err := flush(name); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	return flushAll()
-}
-
-// flush flushes specific set
-func flush(name string) error {
-	if out, err := execCommand(ipsetPath, _flush, name).
-		CombinedOutput(); err != nil {
-		return fmt.Errorf("ipset: can't flush set %s: %s", name, out)
-	}
-	return nil
+	return std.Flush(names...)
 }
 
-// flushAll flushes all set
-func flushAll() error {
-	if out, err := execCommand(ipsetPath, _flush).
-		CombinedOutput(); err != nil {
-		return fmt.Errorf("ipset: can't flush all set: %s", out)
-	}
-	return nil
+// FlushContext is like Flush but aborts as soon as ctx is done.
+func FlushContext(ctx context.Context, names ...string) error {
+	return std.FlushContext(ctx, names...)
 }
 
 // Destroy removes the specified set or all the sets if none is given.
 // If the set has got reference(s), nothing is done and no set destroyed.
 func Destroy(names ...string) error {
-	if len(names) > 0 {
-		for _, name := range names {
-			if err := destroy(name); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	return destroyAll()
+	return std.Destroy(names...)
 }
 
-// destroy removes specific set
-func destroy(name string) error {
-	if out, err := execCommand(ipsetPath, _destroy, name).
-		CombinedOutput(); err != nil {
-		return fmt.Errorf("ipset: can't destroy set %s: %s", name, out)
-	}
-	return nil
-}
-
-// destroyAll removes all set
-func destroyAll() error {
-	if out, err := execCommand(ipsetPath, _destroy).
-		CombinedOutput(); err != nil {
-		return fmt.Errorf("ipset: can't destroy all set: %s", out)
-	}
-	return nil
+// DestroyContext is like Destroy but aborts as soon as ctx is done.
+func DestroyContext(ctx context.Context, names ...string) error {
+	return std.DestroyContext(ctx, names...)
 }
 
 // Swap swaps the content of two sets, or in another words,
 // exchange the action of two sets. The referred sets must
 // exist and compatible type of sets can be swapped only.
 func Swap(from, to string) error {
-	if out, err := execCommand(ipsetPath, _swap, from, to).
-		CombinedOutput(); err != nil {
-		return fmt.Errorf("ipset: can't swap from %s to %s: %s", from, to, out)
-	}
-	return nil
+	return std.Swap(from, to)
 }
 
-//Check checks whether there is an ipset command in the system.
-// If so, check if the version is legal.
-func Check() error {
-	if ipsetPath != "" {
-		return nil
-	}
+// SwapContext is like Swap but aborts as soon as ctx is done.
+func SwapContext(ctx context.Context, from, to string) error {
+	return std.SwapContext(ctx, from, to)
+}
 
-	path, err := execLookPath("ipset")
-	if err != nil {
-		return ErrNotFound
-	}
-	ipsetPath = path
+// DetectVersion returns the full version of the ipset utility,
+// the protocol version and the set types with the revisions ipset
+// supports, which are listed by ipset help. The package constant
+// Version is the version of this package instead.
+func DetectVersion() (*VersionInfo, error) {
+	return std.Version()
+}
 
-	var supported bool
-	if supported, err = isSupported(); err != nil {
-		return fmt.Errorf("ipset: can't check version : %s", err)
-	}
+// DetectVersionContext is like DetectVersion but aborts as soon as
+// ctx is done.
+func DetectVersionContext(ctx context.Context) (*VersionInfo, error) {
+	return std.VersionContext(ctx)
+}
 
-	if supported {
-		return nil
+//Check checks whether there is an ipset command in the system.
+// If so, check if the version is legal. All following operations
+// of the package level functions are done by executing the ipset
+// command. The options configure the ipset command instead of the
+// one found in os path, see NewExecBackend.
+func Check(options ...ExecOption) error {
+	if _, ok := std.backend.(*execBackend); !ok || len(options) > 0 {
+		std = NewClient(NewExecBackend(options...))
 	}
-	return ErrVersionNotSupported
+	return std.Check()
 }
 
-func isSupported() (bool, error) {
-	out, err := execCommand(ipsetPath, _version).
-		CombinedOutput()
-
-	if err == nil {
-		return getMajorVersion(out) >= minMajorVersion, nil
+// CheckNetlink checks whether the kernel speaks a supported version
+// of the ipset netlink protocol. If so, all following operations
+// of the package level functions talk to the kernel directly and
+// no ipset command is required.
+func CheckNetlink() error {
+	c := NewClient(NewNetlinkBackend())
+	if err := c.Check(); err != nil {
+		return err
 	}
-
-	return false, err
+	std = c
+	return nil
 }
 
 func getMajorVersion(version []byte) int {
-	vVer := regexp.MustCompile(" v\\d+(\\.\\d+)+").Find(version)
-	if vVer == nil {
-		return 0
-	}
-	dotIndex := bytes.IndexByte(vVer, '.')
-	var majorVersion int
-	for i := 2; i < dotIndex; i++ {
-		if c := vVer[i]; c >= '0' && c <= '9' {
-			majorVersion = majorVersion*10 + int(c-'0')
-		} else {
-			return 0
-		}
-	}
+	major, _ := getVersion(version)
+	return major
+}
 
-	return majorVersion
+var versionRegexp = regexp.MustCompile(` v(\d+)\.(\d+)`)
+
+// getVersion returns the major and minor version of the ipset
+// utility printed by ipset version, or zeros if it's unknown.
+func getVersion(version []byte) (major, minor int) {
+	m := versionRegexp.FindSubmatch(version)
+	if m == nil {
+		return 0, 0
+	}
+	major, _ = strconv.Atoi(string(m[1]))
+	minor, _ = strconv.Atoi(string(m[2]))
+	return major, minor
 }
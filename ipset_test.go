@@ -1,7 +1,9 @@
 package ipset
 
 import (
+	"context"
 	"fmt"
+	"os/exec"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -11,9 +13,8 @@ import (
 
 func Test_Check(t *testing.T) {
 	t.Run("ipset path is ready", func(t *testing.T) {
-		ipsetPath = "I'm ready"
-		defer func() { ipsetPath = "" }()
-		assert.Nil(t, Check())
+		c := NewClient(&execBackend{path: "I'm ready"})
+		assert.Nil(t, c.Check())
 	})
 
 	t.Run("ipset path is not exist", func(t *testing.T) {
@@ -50,6 +51,31 @@ func Test_Check(t *testing.T) {
 	})
 }
 
+func Test_Check_ExecOptions(t *testing.T) {
+	setupLookPath()
+	defer teardownLookPath()
+
+	var commands [][]string
+	execCommandContext = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		commands = append(commands, append([]string{name}, args...))
+		// the helper process fakes the ipset after the wrapper
+		return fakeExecCommand(ctx, args[1], args[2:]...)
+	}
+	defer teardownCmd()
+
+	require.Nil(t, Check(ExecPath("/usr/sbin/ipset-legacy"), ExecWrapper("sudo", "-n"), ExecEnv("LANG=C")))
+	require.Nil(t, Flush("foo"))
+	assert.Equal(t, [][]string{
+		{"sudo", "-n", "/usr/sbin/ipset-legacy", _version},
+		{"sudo", "-n", "/usr/sbin/ipset-legacy", _flush, "foo"},
+	}, commands)
+
+	b := std.backend.(*execBackend)
+	c := b.command(context.Background(), nil, _version)
+	assert.Contains(t, c.Env, "LANG=C")
+	assert.Contains(t, c.Env, "GO_WANT_HELPER_PROCESS=1")
+}
+
 func Test_GetMajorVersion(t *testing.T) {
 	t.Parallel()
 
@@ -70,6 +96,18 @@ func Test_GetMajorVersion(t *testing.T) {
 	}
 }
 
+func Test_GetVersion(t *testing.T) {
+	t.Parallel()
+
+	major, minor := getVersion([]byte("ipset v7.17, protocol version: 7"))
+	assert.Equal(t, 7, major)
+	assert.Equal(t, 17, minor)
+
+	major, minor = getVersion([]byte("ipset netlink, protocol version: 7"))
+	assert.Equal(t, 0, major)
+	assert.Equal(t, 0, minor)
+}
+
 func Test_New(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		setupCmd()
@@ -0,0 +1,692 @@
+package ipset
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/gonetx/ipset/savefile"
+)
+
+// nlConn is a netlink socket of the nfnetlink subsystem.
+type nlConn interface {
+	// send sends a netlink message to the kernel.
+	send(b []byte) error
+
+	// receive receives one datagram which may hold several
+	// netlink messages. It gives up as soon as ctx is done.
+	// The datagram is only valid until the next receive.
+	receive(ctx context.Context) ([]byte, error)
+
+	// close closes the socket.
+	close() error
+}
+
+// netlinkBackend speaks the ipset netlink protocol to the
+// kernel directly. It understands the same command line
+// arguments as the ipset utility, so the rest of the package
+// doesn't care which backend is in use.
+type netlinkBackend struct {
+	dial     func() (nlConn, error)
+	protocol uint32
+}
+
+func newNetlinkBackend() *netlinkBackend {
+	return &netlinkBackend{dial: dialNetlink}
+}
+
+var nlSeq uint32
+
+// nlBufferSize is big enough for one datagram of a dump.
+const nlBufferSize = 1 << 16
+
+func (b *netlinkBackend) Check() error {
+	conn, err := b.dial()
+	if err != nil {
+		return fmt.Errorf("ipset: can't open netlink socket: %s", err)
+	}
+	defer func() { _ = conn.close() }()
+
+	s := &nlSession{ctx: context.Background(), conn: conn}
+	if err = s.negotiate(); err != nil {
+		if err == ErrVersionNotSupported {
+			return err
+		}
+		return fmt.Errorf("ipset: can't check protocol version: %s", err)
+	}
+	atomic.StoreUint32(&b.protocol, uint32(s.protocol))
+	return nil
+}
+
+func (b *netlinkBackend) Run(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	s, err := b.session(ctx)
+	if err != nil {
+		return []byte(err.Error() + "\n"), err
+	}
+	defer func() { _ = s.conn.close() }()
+
+	args = s.parseFlags(args)
+	if len(args) > 0 && args[0] == _restore {
+		err = s.restore(stdin)
+	} else {
+		err = s.exec(args)
+	}
+	if err != nil {
+		s.out.WriteString(err.Error() + "\n")
+	}
+	return s.out.Bytes(), err
+}
+
+func (b *netlinkBackend) testAll(ctx context.Context, lines [][]string) ([]error, error) {
+	s, err := b.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = s.conn.close() }()
+
+	errs := make([]error, len(lines))
+	for i, args := range lines {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		errs[i] = s.exec(s.parseFlags(args))
+	}
+	return errs, nil
+}
+
+func (b *netlinkBackend) session(ctx context.Context) (*nlSession, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conn, err := b.dial()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open netlink socket: %s", err)
+	}
+
+	s := &nlSession{
+		ctx:      ctx,
+		conn:     conn,
+		protocol: uint8(atomic.LoadUint32(&b.protocol)),
+		headers:  make(map[string]nlHeader),
+	}
+	if s.protocol == 0 {
+		if err = s.negotiate(); err != nil {
+			_ = conn.close()
+			return nil, err
+		}
+		atomic.StoreUint32(&b.protocol, uint32(s.protocol))
+	}
+	return s, nil
+}
+
+// nlHeader is the type data of a set queried from kernel.
+type nlHeader struct {
+	setType  SetType
+	family   uint8
+	revision uint8
+}
+
+// nlSet is a set dumped by list or save.
+type nlSet struct {
+	name    string
+	header  nlHeader
+	data    nlAttrs
+	entries []nlAttrs
+}
+
+// nlSession runs one ipset command or one restore session on
+// a netlink socket.
+type nlSession struct {
+	ctx      context.Context
+	conn     nlConn
+	protocol uint8
+	exist    bool
+	resolve  bool
+	terse    bool
+	names    bool
+	headers  map[string]nlHeader
+	out      bytes.Buffer
+}
+
+// nlError is an error code returned by kernel.
+type nlError int
+
+func (e nlError) Error() string {
+	return "Kernel error received: " + syscall.Errno(e).Error()
+}
+
+// parseFlags strips the global options from args.
+func (s *nlSession) parseFlags(args []string) []string {
+	rest := args[:0:0]
+	for _, arg := range args {
+		switch arg {
+		case _exist, "-!":
+			s.exist = true
+		case _resolve, "-r":
+			s.resolve = true
+		case _terse, "-t":
+			s.terse = true
+		case _names, "-n":
+			s.names = true
+		case "-quiet", "-q":
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest
+}
+
+// negotiate queries the protocol version of kernel and chooses
+// the one both sides support.
+func (s *nlSession) negotiate() error {
+	s.protocol = ipsetProtocolMin
+	msgs, err := s.query(s.request(ipsetCmdProtocol, nfprotoUnspec), false)
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return errNlMalformed
+	}
+
+	version := msgs[0].u8(ipsetAttrProtocol)
+	if min := msgs[0].u8(ipsetAttrProtocolMin); min > s.protocol {
+		s.protocol = min
+	}
+	if version < ipsetProtocolMin || s.protocol > ipsetProtocol {
+		return ErrVersionNotSupported
+	}
+	return nil
+}
+
+// request starts a request with the protocol attribute which
+// kernel requires in every request.
+func (s *nlSession) request(cmd, family uint8) *nlRequest {
+	r := newNlRequest(cmd, family)
+	r.u8(ipsetAttrProtocol, s.protocol)
+	return r
+}
+
+// query sends the request and returns the attributes of all
+// replies. If dump is true, the replies are read until the
+// end of the dump instead of the acknowledgment.
+func (s *nlSession) query(r *nlRequest, dump bool) ([]nlAttrs, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	seq := atomic.AddUint32(&nlSeq, 1)
+	if err := s.conn.send(r.message(seq)); err != nil {
+		return nil, err
+	}
+
+	var replies []nlAttrs
+	for {
+		b, err := s.conn.receive(s.ctx)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := parseNlMessages(b)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.seq != seq {
+				continue
+			}
+			switch m.typ {
+			case nlmsgError:
+				if m.errno != 0 {
+					return nil, nlError(m.errno)
+				}
+				if !dump {
+					return replies, nil
+				}
+			case nlmsgDone:
+				return replies, nil
+			default:
+				replies = append(replies, m.attrs)
+			}
+		}
+	}
+}
+
+// header queries the type data of a set. It's cached during the
+// session and dropped by the commands which may change it.
+func (s *nlSession) header(name string) (nlHeader, error) {
+	if h, ok := s.headers[name]; ok {
+		return h, nil
+	}
+
+	r := s.request(ipsetCmdHeader, nfprotoUnspec)
+	r.str(ipsetAttrSetName, name)
+	msgs, err := s.query(r, false)
+	if err != nil {
+		return nlHeader{}, s.error(ipsetCmdHeader, "", err)
+	}
+	if len(msgs) == 0 {
+		return nlHeader{}, errNlMalformed
+	}
+
+	h := nlHeader{
+		setType:  SetType(msgs[0].str(ipsetAttrTypeName)),
+		family:   msgs[0].u8(ipsetAttrFamily),
+		revision: msgs[0].u8(ipsetAttrRevision),
+	}
+	s.headers[name] = h
+	return h, nil
+}
+
+// exec runs one command.
+func (s *nlSession) exec(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Syntax error: no command specified")
+	}
+
+	action, args := args[0], args[1:]
+	switch action {
+	case _create:
+		if len(args) < 2 {
+			return errors.New("Syntax error: missing set name or type")
+		}
+		return s.create(args[0], SetType(args[1]), args[2:])
+	case _add, _del, _test:
+		if len(args) < 2 {
+			return errors.New("Syntax error: missing set name or element")
+		}
+		return s.adt(action, args[0], args[1], args[2:])
+	case _destroy, _flush:
+		cmd := uint8(ipsetCmdDestroy)
+		if action == _flush {
+			cmd = ipsetCmdFlush
+		}
+		return s.simple(cmd, args...)
+	case _rename, _swap:
+		if len(args) != 2 {
+			return fmt.Errorf("Syntax error: %s requires two set names", action)
+		}
+		cmd := uint8(ipsetCmdRename)
+		if action == _swap {
+			cmd = ipsetCmdSwap
+		}
+		return s.simple(cmd, args...)
+	case _list, _save:
+		return s.list(action, args)
+	case _version:
+		_, _ = fmt.Fprintf(&s.out, "ipset netlink, protocol version: %d\n", s.protocol)
+		return nil
+	case _help:
+		return s.help()
+	}
+	return fmt.Errorf("Syntax error: unknown command %q", action)
+}
+
+func (s *nlSession) create(name string, setType SetType, opts []string) error {
+	var family NetFamily
+	for i := 0; i < len(opts)-1; i++ {
+		if opts[i] == _family {
+			family = NetFamily(opts[i+1])
+		}
+	}
+
+	nfproto := setType.family(family)
+	r := s.request(ipsetCmdType, nfproto)
+	r.str(ipsetAttrTypeName, string(setType))
+	r.u8(ipsetAttrFamily, nfproto)
+	msgs, err := s.query(r, false)
+	if err != nil || len(msgs) == 0 {
+		return errors.New("Kernel error received: set type not supported")
+	}
+
+	r = s.request(ipsetCmdCreate, nfproto)
+	r.str(ipsetAttrSetName, name)
+	r.str(ipsetAttrTypeName, string(setType))
+	r.u8(ipsetAttrRevision, msgs[0].u8(ipsetAttrRevision))
+	r.u8(ipsetAttrFamily, nfproto)
+	if s.exist {
+		r.u32(ipsetAttrFlags, ipsetFlagExist)
+	}
+	r.begin(ipsetAttrData)
+	if err = encodeCreateOptions(s.ctx, r, setType, nfproto, opts); err != nil {
+		return err
+	}
+	r.end()
+
+	delete(s.headers, name)
+	if _, err = s.query(r, false); err != nil {
+		return s.error(ipsetCmdCreate, setType.method(), err)
+	}
+	return nil
+}
+
+func (s *nlSession) adt(action, name, entry string, opts []string) error {
+	h, err := s.header(name)
+	if err != nil {
+		return err
+	}
+
+	cmd := map[string]uint8{_add: ipsetCmdAdd, _del: ipsetCmdDel, _test: ipsetCmdTest}[action]
+	r := s.request(cmd, h.family)
+	r.str(ipsetAttrSetName, name)
+	if s.exist && action != _test {
+		r.u32(ipsetAttrFlags, ipsetFlagExist)
+	}
+	r.begin(ipsetAttrData)
+	flags, err := encodeEntry(s.ctx, r, h.setType, h.family, entry)
+	if err != nil {
+		return err
+	}
+	if err = encodeEntryOptions(r, flags, opts); err != nil {
+		return err
+	}
+	r.end()
+
+	_, err = s.query(r, false)
+	if action == _test {
+		if e, ok := err.(nlError); ok && e == ipsetErrExist {
+			return fmt.Errorf("%s is NOT in set %s.", entry, name)
+		}
+		if err == nil {
+			_, _ = fmt.Fprintf(&s.out, "%s is in set %s.\n", entry, name)
+		}
+	}
+	if err != nil {
+		return s.error(cmd, h.setType.method(), err)
+	}
+	return nil
+}
+
+// help lists the set types kernel supports the same way as the
+// end of ipset help, one line per revision.
+func (s *nlSession) help() error {
+	s.out.WriteString("Supported set types:\n")
+	for _, setType := range setTypes {
+		nfproto := setType.family("")
+		r := s.request(ipsetCmdType, nfproto)
+		r.str(ipsetAttrTypeName, string(setType))
+		r.u8(ipsetAttrFamily, nfproto)
+		msgs, err := s.query(r, false)
+		if e := s.ctx.Err(); e != nil {
+			return e
+		}
+		if err != nil || len(msgs) == 0 {
+			// the module of the set type is missing
+			continue
+		}
+		max, min := msgs[0].u8(ipsetAttrRevision), msgs[0].u8(ipsetAttrRevisionMin)
+		for rev := int(max); rev >= int(min); rev-- {
+			_, _ = fmt.Fprintf(&s.out, "    %s\t%d\n", setType, rev)
+		}
+	}
+	return nil
+}
+
+// simple runs destroy, flush, rename and swap which take set
+// names only.
+func (s *nlSession) simple(cmd uint8, names ...string) error {
+	r := s.request(cmd, nfprotoUnspec)
+	if len(names) > 0 {
+		r.str(ipsetAttrSetName, names[0])
+	}
+	if len(names) > 1 {
+		r.str(ipsetAttrSetName2, names[1])
+	}
+	if cmd != ipsetCmdFlush {
+		s.headers = make(map[string]nlHeader)
+	}
+	if _, err := s.query(r, false); err != nil {
+		return s.error(cmd, "", err)
+	}
+	return nil
+}
+
+func (s *nlSession) list(action string, args []string) error {
+	cmd := uint8(ipsetCmdList)
+	if action == _save {
+		cmd = ipsetCmdSave
+	}
+	r := s.request(cmd, nfprotoUnspec)
+	if len(args) > 0 {
+		r.str(ipsetAttrSetName, args[0])
+	}
+	if s.names && action == _list {
+		r.u32(ipsetAttrFlags, ipsetFlagListSetName)
+	} else if s.terse && action == _list {
+		r.u32(ipsetAttrFlags, ipsetFlagListHeader)
+	}
+	msgs, err := s.query(r, true)
+	if err != nil {
+		return s.error(cmd, "", err)
+	}
+
+	// a big set is dumped in several messages, the first one
+	// holds the header data and all of them hold entries
+	var sets []*nlSet
+	for _, m := range msgs {
+		name := m.str(ipsetAttrSetName)
+		if len(sets) == 0 || sets[len(sets)-1].name != name {
+			sets = append(sets, &nlSet{name: name})
+		}
+		set := sets[len(sets)-1]
+		if m.has(ipsetAttrTypeName) {
+			set.header = nlHeader{
+				setType:  SetType(m.str(ipsetAttrTypeName)),
+				family:   m.u8(ipsetAttrFamily),
+				revision: m.u8(ipsetAttrRevision),
+			}
+		}
+		if m.has(ipsetAttrData) {
+			set.data = m.nested(ipsetAttrData)
+		}
+		for _, a := range m.nested(ipsetAttrADT) {
+			if a.typ == ipsetAttrData {
+				entry, _ := parseNlAttrs(a.data)
+				set.entries = append(set.entries, entry)
+			}
+		}
+	}
+
+	for i, set := range sets {
+		if s.names && action == _list {
+			s.out.WriteString(set.name + "\n")
+			continue
+		}
+		if action == _save {
+			err = s.save(set)
+		} else {
+			if i > 0 {
+				s.out.WriteByte('\n')
+			}
+			err = s.listSet(set)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *nlSession) listSet(set *nlSet) error {
+	elements := len(set.entries)
+	if set.data.has(ipsetAttrElements) {
+		elements = int(set.data.u32(ipsetAttrElements))
+	}
+	_, _ = fmt.Fprintf(&s.out, "Name: %s\nType: %s\nRevision: %d\nHeader: %s\n"+
+		"Size in memory: %d\nReferences: %d\nNumber of entries: %d\n",
+		set.name, set.header.setType, set.header.revision,
+		formatHeader(set.header.setType, set.header.family, set.data),
+		set.data.u32(ipsetAttrMemSize), set.data.u32(ipsetAttrReferences),
+		elements)
+	if s.terse {
+		return nil
+	}
+	s.out.WriteString("Members:\n")
+	for _, entry := range set.entries {
+		// resolving every member may take long
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		s.out.WriteString(formatEntry(s.ctx, set.header.setType, entry, s.resolve))
+		s.out.WriteByte('\n')
+	}
+	return nil
+}
+
+func (s *nlSession) save(set *nlSet) error {
+	_, _ = fmt.Fprintf(&s.out, "%s %s %s %s\n", _create, set.name, set.header.setType,
+		formatHeader(set.header.setType, set.header.family, set.data))
+	for _, entry := range set.entries {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(&s.out, "%s %s %s\n", _add, set.name,
+			formatEntry(s.ctx, set.header.setType, entry, s.resolve))
+	}
+	return nil
+}
+
+// nlMaxLineSize is the max length of a line of restore.
+const nlMaxLineSize = 1 << 16
+
+// restore runs the commands read from stdin line by line.
+func (s *nlSession) restore(stdin []byte) error {
+	exist := s.exist
+	sc := bufio.NewScanner(bytes.NewReader(stdin))
+	sc.Buffer(nil, nlMaxLineSize)
+	for line := 1; sc.Scan(); line++ {
+		t := strings.TrimSpace(sc.Text())
+		if t == "" || t[0] == '#' || t == "COMMIT" {
+			continue
+		}
+
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		args, err := savefile.Split(t)
+		if err != nil {
+			err = fmt.Errorf("Syntax error: %s", err)
+		} else {
+			s.exist = exist
+			err = s.exec(s.parseFlags(args))
+		}
+		if err != nil {
+			return fmt.Errorf("Error in line %d: %s", line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// kernel error codes of ipset, see linux/netfilter/ipset/ip_set.h
+const (
+	ipsetErrProtocol        = 4097
+	ipsetErrFindType        = 4098
+	ipsetErrMaxSets         = 4099
+	ipsetErrBusy            = 4100
+	ipsetErrExistSetName2   = 4101
+	ipsetErrTypeMismatch    = 4102
+	ipsetErrExist           = 4103
+	ipsetErrInvalidCIDR     = 4104
+	ipsetErrInvalidNetmask  = 4105
+	ipsetErrInvalidFamily   = 4106
+	ipsetErrTimeout         = 4107
+	ipsetErrReferenced      = 4108
+	ipsetErrIPAddrIPv4      = 4109
+	ipsetErrIPAddrIPv6      = 4110
+	ipsetErrCounter         = 4111
+	ipsetErrComment         = 4112
+	ipsetErrInvalidMarkmask = 4113
+	ipsetErrSkbinfo         = 4114
+	ipsetErrTypeSpecific    = 4352
+	errnoENOENT             = 2
+	errnoEEXIST             = 17
+	errnoEMSGSIZE           = 90
+)
+
+// nlErrors holds the messages printed by the ipset utility for
+// the kernel error codes, see lib/errcode.c of ipset.
+var nlErrors = map[int]string{
+	errnoENOENT:             "The set with the given name does not exist",
+	errnoEMSGSIZE:           "Kernel error received: message could not be created",
+	ipsetErrProtocol:        "Kernel error received: ipset protocol error",
+	ipsetErrFindType:        "Kernel error received: set type not supported",
+	ipsetErrMaxSets:         "Kernel error received: maximal number of sets reached, cannot create more.",
+	ipsetErrInvalidNetmask:  "The value of the netmask parameter is invalid",
+	ipsetErrInvalidMarkmask: "The value of the markmask parameter is invalid",
+	ipsetErrInvalidFamily:   "Protocol family not supported by the set type",
+	ipsetErrInvalidCIDR:     "The value of the CIDR parameter of the IP address is invalid",
+	ipsetErrTimeout:         "Timeout cannot be used: set was created without timeout support",
+	ipsetErrIPAddrIPv4:      "An IPv4 address is expected, but not received",
+	ipsetErrIPAddrIPv6:      "An IPv6 address is expected, but not received",
+	ipsetErrCounter:         "Packet/byte counters cannot be used: set was created without counter support",
+	ipsetErrComment:         "Comment cannot be used: set was created without comment support",
+	ipsetErrSkbinfo:         "Skbinfo mapping cannot be used: set was created without skbinfo support",
+}
+
+var nlCmdErrors = map[uint8]map[int]string{
+	ipsetCmdCreate: {
+		errnoEEXIST: "Set cannot be created: set with the same name already exists",
+	},
+	ipsetCmdDestroy: {
+		ipsetErrBusy: "Set cannot be destroyed: it is in use by a kernel component",
+	},
+	ipsetCmdRename: {
+		ipsetErrExistSetName2: "Set cannot be renamed: a set with the new name already exists",
+		ipsetErrReferenced:    "Set cannot be renamed: it is in use by another system",
+	},
+	ipsetCmdSwap: {
+		ipsetErrExistSetName2: "Sets cannot be swapped: the second set does not exist",
+		ipsetErrTypeMismatch:  "The sets cannot be swapped: their type does not match",
+	},
+	ipsetCmdAdd: {
+		ipsetErrExist: "Element cannot be added to the set: it's already added",
+	},
+	ipsetCmdDel: {
+		ipsetErrExist: "Element cannot be deleted from the set: it's not added",
+	},
+}
+
+var nlTypeErrors = map[string]map[int]string{
+	"hash": {
+		ipsetErrTypeSpecific:     "Hash is full, cannot add more elements",
+		ipsetErrTypeSpecific + 1: "Null-valued element, cannot be stored in a hash type of set",
+		ipsetErrTypeSpecific + 2: "Invalid protocol specified",
+		ipsetErrTypeSpecific + 3: "Protocol missing, but must be specified",
+		ipsetErrTypeSpecific + 4: "Range is not supported in the \"net\" component of the element",
+		ipsetErrTypeSpecific + 5: "Invalid range, covers the whole address space",
+	},
+	"bitmap": {
+		ipsetErrTypeSpecific:     "Element is out of the range of the set",
+		ipsetErrTypeSpecific + 1: "The range you specified exceeds the size limit of the set type",
+	},
+	"list": {
+		ipsetErrTypeSpecific:     "Set to be added/deleted/tested as element does not exist.",
+		ipsetErrTypeSpecific + 1: "Sets with list:set type cannot be added to the set.",
+		ipsetErrTypeSpecific + 2: "No reference set specified.",
+		ipsetErrTypeSpecific + 3: "The set to which you referred with 'before' or 'after' does not exist.",
+		ipsetErrTypeSpecific + 4: "The set is full, more elements cannot be added.",
+		ipsetErrTypeSpecific + 5: "The set to which you referred with 'before' or 'after' is not added to the set.",
+	},
+}
+
+// error translates the kernel error code of cmd to the message
+// the ipset utility prints. The method of the set type is used to
+// find the type specific messages.
+func (s *nlSession) error(cmd uint8, method string, err error) error {
+	code, ok := err.(nlError)
+	if !ok {
+		return err
+	}
+	if msg, ok := nlCmdErrors[cmd][int(code)]; ok {
+		return errors.New(msg)
+	}
+	if msg, ok := nlTypeErrors[method][int(code)]; ok {
+		return errors.New(msg)
+	}
+	if msg, ok := nlErrors[int(code)]; ok {
+		return errors.New(msg)
+	}
+	return err
+}
@@ -0,0 +1,705 @@
+package ipset
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// method returns the storage method of the set type, i.e.
+// bitmap, hash or list.
+func (t SetType) method() string {
+	if i := strings.IndexByte(string(t), ':'); i != -1 {
+		return string(t)[:i]
+	}
+	return string(t)
+}
+
+// dims returns the data types stored in the set type.
+func (t SetType) dims() []string {
+	if i := strings.IndexByte(string(t), ':'); i != -1 {
+		return strings.Split(string(t)[i+1:], ",")
+	}
+	return nil
+}
+
+// family returns the netlink protocol family of the set type
+// created with the given family option.
+func (t SetType) family(f NetFamily) uint8 {
+	switch {
+	case t == HashMac || t == BitmapPort || t == ListSet:
+		return nfprotoUnspec
+	case f == Inet6 && t.method() == "hash":
+		return nfprotoIPv6
+	}
+	return nfprotoIPv4
+}
+
+var protocols = map[string]uint8{
+	"icmp":      1,
+	"tcp":       6,
+	"udp":       17,
+	"gre":       47,
+	"esp":       50,
+	"ah":        51,
+	"ipv6-icmp": 58,
+	"icmpv6":    58,
+	"sctp":      132,
+	"udplite":   136,
+}
+
+func protocolName(proto uint8) string {
+	switch proto {
+	case 58:
+		return "icmpv6"
+	}
+	for name, p := range protocols {
+		if p == proto && name != "ipv6-icmp" {
+			return name
+		}
+	}
+	return strconv.Itoa(int(proto))
+}
+
+// encodeEntry puts the attributes of entry into the data
+// attribute of r according to the type and family of the set.
+func encodeEntry(ctx context.Context, r *nlRequest, setType SetType, family uint8, entry string) (flags uint32, err error) {
+	if setType == ListSet {
+		r.str(ipsetAttrName, entry)
+		return
+	}
+
+	dims := setType.dims()
+	parts := strings.Split(entry, ",")
+	if len(parts) != len(dims) &&
+		!(setType == BitmapIpMac && len(parts) == 1) {
+		return 0, fmt.Errorf("Syntax error: element %q does not match set type %s", entry, setType)
+	}
+
+	for i, part := range parts {
+		switch dims[i] {
+		case "ip", "net":
+			ipAttr, toAttr, cidrAttr := uint16(ipsetAttrIP), uint16(ipsetAttrIPTo), uint16(ipsetAttrCIDR)
+			if i > 0 {
+				ipAttr, toAttr, cidrAttr = ipsetAttrIP2, ipsetAttrIP2To, ipsetAttrCIDR2
+			}
+			err = encodeIP(ctx, r, ipAttr, toAttr, cidrAttr, family, part)
+		case "port":
+			err = encodePort(ctx, r, setType.method() != "bitmap", part)
+		case "mac":
+			var mac net.HardwareAddr
+			if mac, err = net.ParseMAC(part); err == nil {
+				r.attr(ipsetAttrEther, mac)
+			}
+		case "mark":
+			var mark uint64
+			if mark, err = strconv.ParseUint(part, 0, 32); err == nil {
+				r.u32(ipsetAttrMark, uint32(mark))
+			}
+		case "iface":
+			if strings.HasPrefix(part, "physdev:") {
+				part = part[len("physdev:"):]
+				flags |= ipsetFlagPhysdev
+			}
+			r.str(ipsetAttrIface, part)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("Syntax error: %s", err)
+		}
+	}
+	return
+}
+
+// encodeIP puts an ip, a range or a network into r.
+func encodeIP(ctx context.Context, r *nlRequest, ipAttr, toAttr, cidrAttr uint16, family uint8, s string) error {
+	if i := strings.IndexByte(s, '-'); i != -1 && !strings.HasPrefix(s, "[") {
+		from, err := parseAddr(ctx, s[:i], family)
+		if err != nil {
+			return err
+		}
+		to, err := parseAddr(ctx, s[i+1:], family)
+		if err != nil {
+			return err
+		}
+		r.ip(ipAttr, from)
+		r.ip(toAttr, to)
+		return nil
+	}
+
+	var cidr string
+	if i := strings.LastIndexByte(s, '/'); i != -1 {
+		s, cidr = s[:i], s[i+1:]
+	}
+	ip, err := parseAddr(ctx, s, family)
+	if err != nil {
+		return err
+	}
+	r.ip(ipAttr, ip)
+	if cidr != "" {
+		n, err := strconv.ParseUint(cidr, 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %q", cidr)
+		}
+		r.u8(cidrAttr, uint8(n))
+	}
+	return nil
+}
+
+// parseAddr parses an ip address, a short form IPv4 address
+// such as 192.168.1 or a host name which may be enclosed in
+// square brackets.
+func parseAddr(ctx context.Context, s string, family uint8) (net.IP, error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if ip := net.ParseIP(s); ip != nil {
+		return ip, nil
+	}
+	if ip := parseShortIPv4(s); ip != nil {
+		return ip, nil
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %q to an IP address", s)
+	}
+	for _, addr := range ips {
+		if (addr.IP.To4() != nil) == (family != nfprotoIPv6) {
+			return addr.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot resolve %q to an IP address of the set family", s)
+}
+
+// parseShortIPv4 parses an IPv4 address like inet_aton does, in
+// which the last part fills the rest of the address.
+func parseShortIPv4(s string) net.IP {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil
+	}
+	var ip [4]byte
+	for i, part := range parts {
+		max := uint64(0xff)
+		if i == len(parts)-1 {
+			max = 1<<(8*uint(5-len(parts))) - 1
+		}
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || n > max {
+			return nil
+		}
+		if i < len(parts)-1 {
+			ip[i] = byte(n)
+			continue
+		}
+		for j := 3; j >= i; j-- {
+			ip[j] = byte(n)
+			n >>= 8
+		}
+	}
+	return net.IPv4(ip[0], ip[1], ip[2], ip[3])
+}
+
+// encodePort puts [proto:]port or [proto:]fromport-toport into r.
+func encodePort(ctx context.Context, r *nlRequest, withProto bool, s string) error {
+	proto := "tcp"
+	if i := strings.IndexByte(s, ':'); i != -1 && !strings.HasPrefix(s, "[") {
+		proto, s = s[:i], s[i+1:]
+	}
+	p, ok := protocols[proto]
+	if !ok {
+		n, err := strconv.ParseUint(proto, 10, 8)
+		if err != nil {
+			return fmt.Errorf("unknown protocol %q", proto)
+		}
+		p = uint8(n)
+	}
+
+	var from, to uint16
+	var err error
+	switch {
+	case p == protocols["icmp"] || p == protocols["icmpv6"]:
+		from, err = parseICMP(protocolName(p), s)
+	default:
+		var fromStr, toStr string
+		fromStr, toStr = splitRange(s)
+		if from, err = parsePort(ctx, proto, fromStr); err == nil && toStr != "" {
+			to, err = parsePort(ctx, proto, toStr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	r.u16(ipsetAttrPort, from)
+	if to != 0 {
+		r.u16(ipsetAttrPortTo, to)
+	}
+	if withProto {
+		r.u8(ipsetAttrProto, p)
+	}
+	return nil
+}
+
+// splitRange splits from-to where both parts may be enclosed in
+// square brackets to allow names with dash.
+func splitRange(s string) (from, to string) {
+	if strings.HasPrefix(s, "[") {
+		if i := strings.IndexByte(s, ']'); i != -1 {
+			from, s = s[:i+1], s[i+1:]
+			return from, strings.TrimPrefix(s, "-")
+		}
+	}
+	if i := strings.IndexByte(s, '-'); i != -1 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+func parsePort(ctx context.Context, proto, s string) (uint16, error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if n, err := strconv.ParseUint(s, 10, 16); err == nil {
+		return uint16(n), nil
+	}
+	n, err := net.DefaultResolver.LookupPort(ctx, proto, s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot resolve %q to a port number", s)
+	}
+	return uint16(n), nil
+}
+
+// icmpTypes and icmpv6Types are the names of type/code which
+// ipset accepts, see lib/icmp.c and lib/icmpv6.c of ipset.
+var (
+	icmpTypes = map[string]uint16{
+		"echo-reply":                 0<<8 | 0,
+		"pong":                       0<<8 | 0,
+		"network-unreachable":        3<<8 | 0,
+		"host-unreachable":           3<<8 | 1,
+		"protocol-unreachable":       3<<8 | 2,
+		"port-unreachable":           3<<8 | 3,
+		"fragmentation-needed":       3<<8 | 4,
+		"source-route-failed":        3<<8 | 5,
+		"network-unknown":            3<<8 | 6,
+		"host-unknown":               3<<8 | 7,
+		"network-prohibited":         3<<8 | 9,
+		"host-prohibited":            3<<8 | 10,
+		"TOS-network-unreachable":    3<<8 | 11,
+		"TOS-host-unreachable":       3<<8 | 12,
+		"communication-prohibited":   3<<8 | 13,
+		"host-precedence-violation":  3<<8 | 14,
+		"precedence-cutoff":          3<<8 | 15,
+		"source-quench":              4<<8 | 0,
+		"network-redirect":           5<<8 | 0,
+		"host-redirect":              5<<8 | 1,
+		"TOS-network-redirect":       5<<8 | 2,
+		"TOS-host-redirect":          5<<8 | 3,
+		"echo-request":               8<<8 | 0,
+		"ping":                       8<<8 | 0,
+		"router-advertisement":       9<<8 | 0,
+		"router-solicitation":        10<<8 | 0,
+		"ttl-zero-during-transit":    11<<8 | 0,
+		"ttl-zero-during-reassembly": 11<<8 | 1,
+		"ip-header-bad":              12<<8 | 0,
+		"required-option-missing":    12<<8 | 1,
+		"timestamp-request":          13<<8 | 0,
+		"timestamp-reply":            14<<8 | 0,
+		"address-mask-request":       17<<8 | 0,
+		"address-mask-reply":         18<<8 | 0,
+	}
+	icmpv6Types = map[string]uint16{
+		"no-route":                   1<<8 | 0,
+		"communication-prohibited":   1<<8 | 1,
+		"address-unreachable":        1<<8 | 3,
+		"port-unreachable":           1<<8 | 4,
+		"packet-too-big":             2<<8 | 0,
+		"ttl-zero-during-transit":    3<<8 | 0,
+		"ttl-zero-during-reassembly": 3<<8 | 1,
+		"bad-header":                 4<<8 | 0,
+		"unknown-header-type":        4<<8 | 1,
+		"unknown-option":             4<<8 | 2,
+		"echo-request":               128<<8 | 0,
+		"ping":                       128<<8 | 0,
+		"echo-reply":                 129<<8 | 0,
+		"pong":                       129<<8 | 0,
+	}
+)
+
+// parseICMP parses type/code or the name of type/code of icmp
+// or icmpv6 which is stored as port.
+func parseICMP(proto, s string) (uint16, error) {
+	names := icmpTypes
+	if proto != "icmp" {
+		names = icmpv6Types
+	}
+	if n, ok := names[s]; ok {
+		return n, nil
+	}
+	i := strings.IndexByte(s, '/')
+	if i == -1 {
+		return 0, fmt.Errorf("invalid ICMP type/code %q", s)
+	}
+	typ, err := strconv.ParseUint(s[:i], 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ICMP type %q", s[:i])
+	}
+	code, err := strconv.ParseUint(s[i+1:], 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ICMP code %q", s[i+1:])
+	}
+	return uint16(typ<<8 | code), nil
+}
+
+// encodeEntryOptions puts the options of add, del and test into r.
+func encodeEntryOptions(r *nlRequest, flags uint32, opts []string) error {
+	for i := 0; i < len(opts); i++ {
+		opt := opts[i]
+		switch opt {
+		case _nomatch:
+			flags |= ipsetFlagNomatch
+			continue
+		case _timeout, _packets, _bytes, _comment, _skbmark,
+			_skbprio, _skbqueue, "before", "after":
+		default:
+			return fmt.Errorf("Syntax error: unknown argument %q", opt)
+		}
+
+		if i++; i == len(opts) {
+			return fmt.Errorf("Syntax error: missing value of %s", opt)
+		}
+		v := opts[i]
+
+		var err error
+		switch opt {
+		case _timeout:
+			err = putUint(r, ipsetAttrTimeout, v, 32)
+		case _packets:
+			err = putUint(r, ipsetAttrPackets, v, 64)
+		case _bytes:
+			err = putUint(r, ipsetAttrBytes, v, 64)
+		case _comment:
+			r.str(ipsetAttrComment, v)
+		case _skbmark:
+			var mark uint64
+			if mark, err = parseSkbmark(v); err == nil {
+				r.u64(ipsetAttrSkbMark, mark)
+			}
+		case _skbprio:
+			var prio uint32
+			if prio, err = parseSkbprio(v); err == nil {
+				r.u32(ipsetAttrSkbPrio, prio)
+			}
+		case _skbqueue:
+			err = putUint(r, ipsetAttrSkbQueue, v, 16)
+		case "before", "after":
+			if opt == "before" {
+				flags |= ipsetFlagBefore
+			}
+			r.str(ipsetAttrNameRef, v)
+		}
+		if err != nil {
+			return fmt.Errorf("Syntax error: invalid %s value %q", opt, v)
+		}
+	}
+
+	if flags != 0 {
+		r.u32(ipsetAttrCadtFlags, flags)
+	}
+	return nil
+}
+
+func putUint(r *nlRequest, typ uint16, s string, bits int) error {
+	n, err := strconv.ParseUint(s, 0, bits)
+	if err != nil {
+		return err
+	}
+	switch bits {
+	case 16:
+		r.u16(typ, uint16(n))
+	case 32:
+		r.u32(typ, uint32(n))
+	default:
+		r.u64(typ, n)
+	}
+	return nil
+}
+
+// parseSkbmark parses MARK or MARK/MASK into mark<<32|mask.
+func parseSkbmark(s string) (uint64, error) {
+	mask := uint64(0xffffffff)
+	if i := strings.IndexByte(s, '/'); i != -1 {
+		m, err := strconv.ParseUint(s[i+1:], 0, 32)
+		if err != nil {
+			return 0, err
+		}
+		s, mask = s[:i], m
+	}
+	mark, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, err
+	}
+	return mark<<32 | mask, nil
+}
+
+// parseSkbprio parses MAJOR:MINOR in hex into major<<16|minor.
+func parseSkbprio(s string) (uint32, error) {
+	i := strings.IndexByte(s, ':')
+	if i == -1 {
+		return 0, fmt.Errorf("invalid skbprio %q", s)
+	}
+	major, err := strconv.ParseUint(s[:i], 16, 16)
+	if err != nil {
+		return 0, err
+	}
+	minor, err := strconv.ParseUint(s[i+1:], 16, 16)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(major<<16 | minor), nil
+}
+
+// encodeCreateOptions puts the create options into r. The
+// family option is put by the caller at command level.
+func encodeCreateOptions(ctx context.Context, r *nlRequest, setType SetType, family uint8, opts []string) (err error) {
+	var flags uint32
+	for i := 0; i < len(opts); i++ {
+		opt := opts[i]
+		switch opt {
+		case _counters:
+			flags |= ipsetFlagWithCounters
+			continue
+		case _comment:
+			flags |= ipsetFlagWithComment
+			continue
+		case _skbinfo:
+			flags |= ipsetFlagWithSkbinfo
+			continue
+		case _forceadd:
+			flags |= ipsetFlagWithForceadd
+			continue
+		case _family, _timeout, _hashsize, _maxelem, _bucketsize,
+			_initval, _netmask, _bitmask, _markmask, _size, _range:
+		default:
+			return fmt.Errorf("Syntax error: unknown argument %q", opt)
+		}
+
+		if i++; i == len(opts) {
+			return fmt.Errorf("Syntax error: missing value of %s", opt)
+		}
+		v := opts[i]
+
+		switch opt {
+		case _family:
+			if NetFamily(v) != Inet && NetFamily(v) != Inet6 {
+				err = fmt.Errorf("unknown family")
+			}
+		case _timeout:
+			err = putUint(r, ipsetAttrTimeout, v, 32)
+		case _hashsize:
+			err = putUint(r, ipsetAttrHashSize, v, 32)
+		case _maxelem:
+			err = putUint(r, ipsetAttrMaxElem, v, 32)
+		case _bucketsize:
+			var n uint64
+			if n, err = strconv.ParseUint(v, 10, 8); err == nil {
+				r.u8(ipsetAttrBucketSize, uint8(n))
+			}
+		case _initval:
+			err = putUint(r, ipsetAttrInitval, v, 32)
+		case _markmask:
+			err = putUint(r, ipsetAttrMarkmask, v, 32)
+		case _size:
+			err = putUint(r, ipsetAttrSize, v, 32)
+		case _netmask:
+			var n uint64
+			if n, err = strconv.ParseUint(v, 10, 8); err == nil {
+				r.u8(ipsetAttrNetmask, uint8(n))
+			}
+		case _bitmask:
+			ip := net.ParseIP(v)
+			if ip == nil || (ip.To4() != nil) == (family == nfprotoIPv6) {
+				err = fmt.Errorf("invalid address")
+			} else {
+				r.ip(ipsetAttrBitmask, ip)
+			}
+		case _range:
+			if setType == BitmapPort {
+				err = encodePort(ctx, r, false, v)
+			} else {
+				err = encodeIP(ctx, r, ipsetAttrIP, ipsetAttrIPTo, ipsetAttrCIDR, nfprotoIPv4, v)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Syntax error: invalid %s value %q", opt, v)
+		}
+	}
+
+	if flags != 0 {
+		r.u32(ipsetAttrCadtFlags, flags)
+	}
+	return
+}
+
+// formatHeader formats the create data of a set the same way as
+// the header of ipset list.
+func formatHeader(setType SetType, family uint8, data nlAttrs) string {
+	var b strings.Builder
+	add := func(format string, a ...interface{}) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		_, _ = fmt.Fprintf(&b, format, a...)
+	}
+
+	switch setType.method() {
+	case "hash":
+		if setType != HashMac {
+			if family == nfprotoIPv6 {
+				add("%s %s", _family, Inet6)
+			} else {
+				add("%s %s", _family, Inet)
+			}
+		}
+		add("%s %d", _hashsize, data.u32(ipsetAttrHashSize))
+		add("%s %d", _maxelem, data.u32(ipsetAttrMaxElem))
+		if data.has(ipsetAttrNetmask) {
+			add("%s %d", _netmask, data.u8(ipsetAttrNetmask))
+		}
+		if data.has(ipsetAttrBitmask) {
+			add("%s %s", _bitmask, data.ip(ipsetAttrBitmask))
+		}
+		if data.has(ipsetAttrMarkmask) {
+			add("%s 0x%08x", _markmask, data.u32(ipsetAttrMarkmask))
+		}
+		if data.has(ipsetAttrBucketSize) {
+			add("bucketsize %d", data.u8(ipsetAttrBucketSize))
+		}
+		if data.has(ipsetAttrInitval) {
+			add("initval 0x%08x", data.u32(ipsetAttrInitval))
+		}
+	case "bitmap":
+		if setType == BitmapPort {
+			add("%s %d-%d", _range, data.u16(ipsetAttrPort), data.u16(ipsetAttrPortTo))
+		} else {
+			add("%s %s-%s", _range, data.ip(ipsetAttrIP), data.ip(ipsetAttrIPTo))
+		}
+		if data.has(ipsetAttrNetmask) {
+			add("%s %d", _netmask, data.u8(ipsetAttrNetmask))
+		}
+	case "list":
+		add("%s %d", _size, data.u32(ipsetAttrSize))
+	}
+
+	if data.has(ipsetAttrTimeout) {
+		add("%s %d", _timeout, data.u32(ipsetAttrTimeout))
+	}
+	flags := data.u32(ipsetAttrCadtFlags)
+	if flags&ipsetFlagWithCounters != 0 {
+		add(_counters)
+	}
+	if flags&ipsetFlagWithComment != 0 {
+		add(_comment)
+	}
+	if flags&ipsetFlagWithSkbinfo != 0 {
+		add(_skbinfo)
+	}
+	if flags&ipsetFlagWithForceadd != 0 {
+		add(_forceadd)
+	}
+	return b.String()
+}
+
+// formatEntry formats an entry of a set the same way as ipset
+// list and save does. If resolve is true, the ip of the first
+// dimension is looked up for its host name.
+func formatEntry(ctx context.Context, setType SetType, data nlAttrs, resolve bool) string {
+	var b strings.Builder
+	if setType == ListSet {
+		b.WriteString(data.str(ipsetAttrName))
+	}
+
+	for i, dim := range setType.dims() {
+		if setType == ListSet {
+			break
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		switch dim {
+		case "ip", "net":
+			ipAttr, cidrAttr := uint16(ipsetAttrIP), uint16(ipsetAttrCIDR)
+			if i > 0 {
+				ipAttr, cidrAttr = ipsetAttrIP2, ipsetAttrCIDR2
+			}
+			b.WriteString(formatIP(ctx, data.ip(ipAttr), data, cidrAttr, resolve && i == 0))
+		case "port":
+			port := data.u16(ipsetAttrPort)
+			if setType.method() == "bitmap" {
+				b.WriteString(strconv.Itoa(int(port)))
+				break
+			}
+			proto := data.u8(ipsetAttrProto)
+			if proto == protocols["icmp"] || proto == protocols["icmpv6"] {
+				_, _ = fmt.Fprintf(&b, "%s:%d/%d", protocolName(proto), port>>8, port&0xff)
+			} else {
+				_, _ = fmt.Fprintf(&b, "%s:%d", protocolName(proto), port)
+			}
+		case "mac":
+			b.WriteString(strings.ToUpper(net.HardwareAddr(data.get(ipsetAttrEther)).String()))
+		case "mark":
+			_, _ = fmt.Fprintf(&b, "0x%08x", data.u32(ipsetAttrMark))
+		case "iface":
+			if data.u32(ipsetAttrCadtFlags)&ipsetFlagPhysdev != 0 {
+				b.WriteString("physdev:")
+			}
+			b.WriteString(data.str(ipsetAttrIface))
+		}
+	}
+
+	if data.has(ipsetAttrTimeout) {
+		_, _ = fmt.Fprintf(&b, " %s %d", _timeout, data.u32(ipsetAttrTimeout))
+	}
+	if data.has(ipsetAttrPackets) {
+		_, _ = fmt.Fprintf(&b, " %s %d", _packets, data.u64(ipsetAttrPackets))
+	}
+	if data.has(ipsetAttrBytes) {
+		_, _ = fmt.Fprintf(&b, " %s %d", _bytes, data.u64(ipsetAttrBytes))
+	}
+	if data.has(ipsetAttrComment) {
+		_, _ = fmt.Fprintf(&b, " %s \"%s\"", _comment, data.str(ipsetAttrComment))
+	}
+	if data.has(ipsetAttrSkbMark) {
+		mark := data.u64(ipsetAttrSkbMark)
+		if mask := uint32(mark); mask != 0xffffffff {
+			_, _ = fmt.Fprintf(&b, " %s 0x%x/0x%x", _skbmark, uint32(mark>>32), mask)
+		} else {
+			_, _ = fmt.Fprintf(&b, " %s 0x%x", _skbmark, uint32(mark>>32))
+		}
+	}
+	if data.has(ipsetAttrSkbPrio) {
+		prio := data.u32(ipsetAttrSkbPrio)
+		_, _ = fmt.Fprintf(&b, " %s %x:%x", _skbprio, prio>>16, prio&0xffff)
+	}
+	if data.has(ipsetAttrSkbQueue) {
+		_, _ = fmt.Fprintf(&b, " %s %d", _skbqueue, data.u16(ipsetAttrSkbQueue))
+	}
+	if data.u32(ipsetAttrCadtFlags)&ipsetFlagNomatch != 0 {
+		b.WriteString(" " + _nomatch)
+	}
+	return b.String()
+}
+
+func formatIP(ctx context.Context, ip net.IP, data nlAttrs, cidrAttr uint16, resolve bool) string {
+	bits := uint8(net.IPv6len * 8)
+	if ip.To4() != nil {
+		bits = net.IPv4len * 8
+	}
+	if data.has(cidrAttr) && data.u8(cidrAttr) < bits {
+		return fmt.Sprintf("%s/%d", ip, data.u8(cidrAttr))
+	}
+	if resolve {
+		if names, err := net.DefaultResolver.LookupAddr(ctx, ip.String()); err == nil && len(names) > 0 {
+			return strings.TrimSuffix(names[0], ".")
+		}
+	}
+	return ip.String()
+}
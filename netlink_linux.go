@@ -0,0 +1,64 @@
+package ipset
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// nlPollInterval is how often a blocked receive checks whether
+// its context is done.
+const nlPollInterval = 100 * time.Millisecond
+
+// socketConn is a netlink socket of NETLINK_NETFILTER.
+type socketConn struct {
+	fd  int
+	buf []byte
+}
+
+func dialNetlink() (nlConn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	tv := syscall.NsecToTimeval(nlPollInterval.Nanoseconds())
+	if err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+	return &socketConn{fd: fd, buf: make([]byte, nlBufferSize)}, nil
+}
+
+func (c *socketConn) send(b []byte) error {
+	err := syscall.Sendto(c.fd, b, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	return os.NewSyscallError("sendto", err)
+}
+
+func (c *socketConn) receive(ctx context.Context) ([]byte, error) {
+	for {
+		n, _, err := syscall.Recvfrom(c.fd, c.buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, os.NewSyscallError("recvfrom", err)
+		}
+		return c.buf[:n], nil
+	}
+}
+
+func (c *socketConn) close() error {
+	return syscall.Close(c.fd)
+}
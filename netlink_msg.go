@@ -0,0 +1,378 @@
+package ipset
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"unsafe"
+)
+
+// netlink constants, see linux/netlink.h and
+// linux/netfilter/nfnetlink.h
+const (
+	nlmsgHdrLen  = 16
+	nfgenmsgLen  = 4
+	nlattrHdrLen = 4
+
+	nlmsgError = 0x2
+	nlmsgDone  = 0x3
+
+	nlmFRequest = 0x1
+	nlmFAck     = 0x4
+
+	nlaFNested   = 0x8000
+	nlaFNetOrder = 0x4000
+	nlaTypeMask  = ^uint16(nlaFNested | nlaFNetOrder)
+
+	nfnlSubsysIPSet = 6
+	nfnetlinkV0     = 0
+)
+
+// ipset netlink protocol, see linux/netfilter/ipset/ip_set.h
+const (
+	ipsetProtocol    = 7
+	ipsetProtocolMin = 6
+	ipsetMaxNameLen  = 32
+)
+
+// protocol families
+const (
+	nfprotoUnspec = 0
+	nfprotoIPv4   = 2
+	nfprotoIPv6   = 10
+)
+
+// ipset commands
+const (
+	ipsetCmdProtocol = 1
+	ipsetCmdCreate   = 2
+	ipsetCmdDestroy  = 3
+	ipsetCmdFlush    = 4
+	ipsetCmdRename   = 5
+	ipsetCmdSwap     = 6
+	ipsetCmdList     = 7
+	ipsetCmdSave     = 8
+	ipsetCmdAdd      = 9
+	ipsetCmdDel      = 10
+	ipsetCmdTest     = 11
+	ipsetCmdHeader   = 12
+	ipsetCmdType     = 13
+)
+
+// attributes at command level
+const (
+	ipsetAttrProtocol    = 1
+	ipsetAttrSetName     = 2
+	ipsetAttrTypeName    = 3
+	ipsetAttrSetName2    = ipsetAttrTypeName
+	ipsetAttrRevision    = 4
+	ipsetAttrFamily      = 5
+	ipsetAttrFlags       = 6
+	ipsetAttrData        = 7
+	ipsetAttrADT         = 8
+	ipsetAttrLineNo      = 9
+	ipsetAttrProtocolMin = 10
+	ipsetAttrRevisionMin = ipsetAttrProtocolMin
+)
+
+// create and add/del/test specific attributes
+const (
+	ipsetAttrIP        = 1
+	ipsetAttrIPTo      = 2
+	ipsetAttrCIDR      = 3
+	ipsetAttrPort      = 4
+	ipsetAttrPortTo    = 5
+	ipsetAttrTimeout   = 6
+	ipsetAttrProto     = 7
+	ipsetAttrCadtFlags = 8
+	ipsetAttrMark      = 10
+	ipsetAttrMarkmask  = 11
+	ipsetAttrBitmask   = 12
+
+	ipsetAttrInitval    = 17
+	ipsetAttrHashSize   = 18
+	ipsetAttrMaxElem    = 19
+	ipsetAttrNetmask    = 20
+	ipsetAttrBucketSize = 21
+	ipsetAttrSize       = 23
+	ipsetAttrElements   = 24
+	ipsetAttrReferences = 25
+	ipsetAttrMemSize    = 26
+
+	ipsetAttrEther    = 17
+	ipsetAttrName     = 18
+	ipsetAttrNameRef  = 19
+	ipsetAttrIP2      = 20
+	ipsetAttrCIDR2    = 21
+	ipsetAttrIP2To    = 22
+	ipsetAttrIface    = 23
+	ipsetAttrBytes    = 24
+	ipsetAttrPackets  = 25
+	ipsetAttrComment  = 26
+	ipsetAttrSkbMark  = 27
+	ipsetAttrSkbPrio  = 28
+	ipsetAttrSkbQueue = 29
+)
+
+// attributes of a nested ip address
+const (
+	ipsetAttrIPAddrIPv4 = 1
+	ipsetAttrIPAddrIPv6 = 2
+)
+
+// command level flags
+const (
+	ipsetFlagExist       = 1 << 0
+	ipsetFlagListSetName = 1 << 1
+	ipsetFlagListHeader  = 1 << 2
+)
+
+// create and add/del/test level flags
+const (
+	ipsetFlagBefore       = 1 << 0
+	ipsetFlagPhysdev      = 1 << 1
+	ipsetFlagNomatch      = 1 << 2
+	ipsetFlagWithCounters = 1 << 3
+	ipsetFlagWithComment  = 1 << 4
+	ipsetFlagWithForceadd = 1 << 5
+	ipsetFlagWithSkbinfo  = 1 << 6
+)
+
+var errNlMalformed = errors.New("malformed netlink message")
+
+// nativeEndian is the byte order of netlink headers.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 { // #nosec G103
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// nlRequest builds an ipset netlink request.
+type nlRequest struct {
+	cmd   uint8
+	b     []byte
+	nests []int
+}
+
+func newNlRequest(cmd, family uint8) *nlRequest {
+	r := &nlRequest{cmd: cmd, b: make([]byte, nlmsgHdrLen+nfgenmsgLen, 256)}
+	r.b[nlmsgHdrLen] = family
+	r.b[nlmsgHdrLen+1] = nfnetlinkV0
+	return r
+}
+
+func (r *nlRequest) attr(typ uint16, data []byte) {
+	var hdr [nlattrHdrLen]byte
+	nativeEndian.PutUint16(hdr[0:], uint16(nlattrHdrLen+len(data)))
+	nativeEndian.PutUint16(hdr[2:], typ)
+	r.b = append(r.b, hdr[:]...)
+	r.b = append(r.b, data...)
+	for len(r.b)%4 != 0 {
+		r.b = append(r.b, 0)
+	}
+}
+
+func (r *nlRequest) u8(typ uint16, v uint8) {
+	r.attr(typ, []byte{v})
+}
+
+func (r *nlRequest) u16(typ uint16, v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	r.attr(typ|nlaFNetOrder, b[:])
+}
+
+func (r *nlRequest) u32(typ uint16, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	r.attr(typ|nlaFNetOrder, b[:])
+}
+
+func (r *nlRequest) u64(typ uint16, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	r.attr(typ|nlaFNetOrder, b[:])
+}
+
+func (r *nlRequest) str(typ uint16, s string) {
+	r.attr(typ, append([]byte(s), 0))
+}
+
+func (r *nlRequest) ip(typ uint16, ip net.IP) {
+	r.begin(typ)
+	if v4 := ip.To4(); v4 != nil {
+		r.attr(ipsetAttrIPAddrIPv4|nlaFNetOrder, v4)
+	} else {
+		r.attr(ipsetAttrIPAddrIPv6|nlaFNetOrder, ip.To16())
+	}
+	r.end()
+}
+
+// begin starts a nested attribute which is finished by end.
+func (r *nlRequest) begin(typ uint16) {
+	r.nests = append(r.nests, len(r.b))
+	r.attr(typ|nlaFNested, nil)
+}
+
+func (r *nlRequest) end() {
+	i := r.nests[len(r.nests)-1]
+	r.nests = r.nests[:len(r.nests)-1]
+	nativeEndian.PutUint16(r.b[i:], uint16(len(r.b)-i))
+}
+
+// message finishes the request with the sequence number.
+func (r *nlRequest) message(seq uint32) []byte {
+	nativeEndian.PutUint32(r.b[0:], uint32(len(r.b)))
+	nativeEndian.PutUint16(r.b[4:], nfnlSubsysIPSet<<8|uint16(r.cmd))
+	nativeEndian.PutUint16(r.b[6:], nlmFRequest|nlmFAck)
+	nativeEndian.PutUint32(r.b[8:], seq)
+	nativeEndian.PutUint32(r.b[12:], 0)
+	return r.b
+}
+
+// nlMessage is a netlink message received from the kernel.
+type nlMessage struct {
+	typ   uint16
+	seq   uint32
+	errno int
+	attrs nlAttrs
+}
+
+// parseNlMessages parses the netlink messages in b. The attributes
+// of the messages don't share memory with b, as the datagram may be
+// overwritten by the next receive.
+func parseNlMessages(b []byte) ([]nlMessage, error) {
+	b = append([]byte(nil), b...)
+	var msgs []nlMessage
+	for len(b) >= nlmsgHdrLen {
+		l := int(nativeEndian.Uint32(b[0:]))
+		if l < nlmsgHdrLen || l > len(b) {
+			return nil, errNlMalformed
+		}
+		m := nlMessage{
+			typ: nativeEndian.Uint16(b[4:]),
+			seq: nativeEndian.Uint32(b[8:]),
+		}
+		payload := b[nlmsgHdrLen:l]
+		switch {
+		case m.typ == nlmsgError:
+			if len(payload) < 4 {
+				return nil, errNlMalformed
+			}
+			m.errno = -int(int32(nativeEndian.Uint32(payload)))
+		case m.typ == nlmsgDone:
+		case len(payload) >= nfgenmsgLen:
+			var err error
+			if m.attrs, err = parseNlAttrs(payload[nfgenmsgLen:]); err != nil {
+				return nil, err
+			}
+		}
+		msgs = append(msgs, m)
+		if nlAlign(l) >= len(b) {
+			break
+		}
+		b = b[nlAlign(l):]
+	}
+	return msgs, nil
+}
+
+// nlAttr is a netlink attribute whose type is stripped of the
+// nested and byte order flags.
+type nlAttr struct {
+	typ  uint16
+	data []byte
+}
+
+type nlAttrs []nlAttr
+
+func parseNlAttrs(b []byte) (nlAttrs, error) {
+	var attrs nlAttrs
+	for len(b) >= nlattrHdrLen {
+		l := int(nativeEndian.Uint16(b[0:]))
+		if l < nlattrHdrLen || l > len(b) {
+			return nil, errNlMalformed
+		}
+		attrs = append(attrs, nlAttr{
+			typ:  nativeEndian.Uint16(b[2:]) & nlaTypeMask,
+			data: b[nlattrHdrLen:l],
+		})
+		if nlAlign(l) >= len(b) {
+			break
+		}
+		b = b[nlAlign(l):]
+	}
+	return attrs, nil
+}
+
+func nlAlign(l int) int {
+	return (l + 3) &^ 3
+}
+
+func (as nlAttrs) get(typ uint16) []byte {
+	for _, a := range as {
+		if a.typ == typ {
+			return a.data
+		}
+	}
+	return nil
+}
+
+func (as nlAttrs) has(typ uint16) bool {
+	return as.get(typ) != nil
+}
+
+func (as nlAttrs) u8(typ uint16) uint8 {
+	if b := as.get(typ); len(b) >= 1 {
+		return b[0]
+	}
+	return 0
+}
+
+func (as nlAttrs) u16(typ uint16) uint16 {
+	if b := as.get(typ); len(b) >= 2 {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (as nlAttrs) u32(typ uint16) uint32 {
+	if b := as.get(typ); len(b) >= 4 {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (as nlAttrs) u64(typ uint16) uint64 {
+	if b := as.get(typ); len(b) >= 8 {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (as nlAttrs) str(typ uint16) string {
+	b := as.get(typ)
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func (as nlAttrs) nested(typ uint16) nlAttrs {
+	attrs, _ := parseNlAttrs(as.get(typ))
+	return attrs
+}
+
+func (as nlAttrs) ip(typ uint16) net.IP {
+	addr := as.nested(typ)
+	if b := addr.get(ipsetAttrIPAddrIPv4); len(b) == net.IPv4len {
+		return net.IPv4(b[0], b[1], b[2], b[3])
+	}
+	if b := addr.get(ipsetAttrIPAddrIPv6); len(b) == net.IPv6len {
+		return net.IP(append([]byte(nil), b...))
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package ipset
+
+import "errors"
+
+func dialNetlink() (nlConn, error) {
+	return nil, errors.New("netlink is only supported on linux")
+}
@@ -0,0 +1,363 @@
+package ipset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Netlink_Check(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		k := newFakeKernel()
+		b := k.backend()
+		require.Nil(t, b.Check())
+		assert.Equal(t, uint32(ipsetProtocolMin), b.protocol)
+	})
+
+	t.Run("dial error", func(t *testing.T) {
+		b := &netlinkBackend{dial: func() (nlConn, error) {
+			return nil, errors.New("permission denied")
+		}}
+		err := b.Check()
+		require.Error(t, err)
+		assert.Equal(t, "ipset: can't open netlink socket: permission denied", err.Error())
+	})
+
+	t.Run("non supported protocol", func(t *testing.T) {
+		k := newFakeKernel()
+		k.protocol = 5
+		assert.Equal(t, ErrVersionNotSupported, k.backend().Check())
+	})
+}
+
+func Test_Netlink_Run(t *testing.T) {
+	k := newFakeKernel()
+	b := k.backend()
+
+	run := func(args ...string) (string, error) {
+		out, err := b.Run(context.Background(), nil, args...)
+		return string(out), err
+	}
+
+	_, err := run(_create, "foo", string(HashIp), _timeout, "300", _comment, _counters)
+	require.Nil(t, err)
+
+	out, err := run(_create, "foo", string(HashIp))
+	require.Error(t, err)
+	assert.Equal(t, "Set cannot be created: set with the same name already exists\n", out)
+
+	_, err = run(_create, "foo", string(HashIp), _exist)
+	require.Nil(t, err)
+
+	_, err = run(_add, "foo", "1.1.1.1", _timeout, "60", _comment, "x y")
+	require.Nil(t, err)
+
+	out, err = run(_add, "foo", "1.1.1.1")
+	require.Error(t, err)
+	assert.Equal(t, "Element cannot be added to the set: it's already added\n", out)
+
+	out, err = run(_test, "foo", "1.1.1.1")
+	require.Nil(t, err)
+	assert.Equal(t, "1.1.1.1 is in set foo.\n", out)
+
+	out, err = run(_test, "foo", "1.1.1.2")
+	require.Error(t, err)
+	assert.Contains(t, out, "NOT")
+
+	out, err = run(_list, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, `Name: foo
+Type: hash:ip
+Revision: 4
+Header: family inet hashsize 0 maxelem 0 timeout 300 counters comment
+Size in memory: 168
+References: 0
+Number of entries: 1
+Members:
+1.1.1.1 timeout 60 comment "x y"
+`, out)
+
+	out, err = run(_save, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, `create foo hash:ip family inet hashsize 0 maxelem 0 timeout 300 counters comment
+add foo 1.1.1.1 timeout 60 comment "x y"
+`, out)
+
+	_, err = run(_del, "foo", "1.1.1.1")
+	require.Nil(t, err)
+
+	out, err = run(_del, "foo", "1.1.1.1")
+	require.Error(t, err)
+	assert.Equal(t, "Element cannot be deleted from the set: it's not added\n", out)
+
+	_, err = run(_rename, "foo", "bar")
+	require.Nil(t, err)
+
+	out, err = run(_flush, "foo")
+	require.Error(t, err)
+	assert.Equal(t, "The set with the given name does not exist\n", out)
+
+	_, err = run(_destroy)
+	require.Nil(t, err)
+	assert.Len(t, k.sets, 0)
+
+	out, err = run(_create, "foo", "hash:unknown")
+	require.Error(t, err)
+	assert.Equal(t, "Kernel error received: set type not supported\n", out)
+
+	out, err = run(_version)
+	require.Nil(t, err)
+	assert.Equal(t, "ipset netlink, protocol version: 6\n", out)
+}
+
+func Test_Netlink_Restore(t *testing.T) {
+	k := newFakeKernel()
+	b := k.backend()
+
+	_, err := b.Run(context.Background(), []byte(`create foo hash:net family inet hashsize 1024 maxelem 65536 comment
+add foo 10.0.0.0/8 comment "private network"
+add foo 192.168.0.0/16 nomatch
+
+COMMIT
+`), _restore)
+	require.Nil(t, err)
+
+	out, err := b.Run(context.Background(), nil, _save)
+	require.Nil(t, err)
+	assert.Equal(t, `create foo hash:net family inet hashsize 1024 maxelem 65536 comment
+add foo 10.0.0.0/8 comment "private network"
+add foo 192.168.0.0/16 nomatch
+`, string(out))
+
+	out, err = b.Run(context.Background(), []byte("add foo 1.1.1.0/24\nadd foo 10.0.0.0/8\n"), _restore)
+	require.Error(t, err)
+	assert.Equal(t, "Error in line 2: Element cannot be added to the set: it's already added\n", string(out))
+
+	_, err = b.Run(context.Background(), []byte("add foo 10.0.0.0/8\n"), _restore, _exist)
+	require.Nil(t, err)
+
+	out, err = b.Run(context.Background(), []byte("add foo 10.0.0.0/8 comment \"x\n"), _restore)
+	require.Error(t, err)
+	assert.Equal(t, "Error in line 1: Syntax error: missing close quote\n", string(out))
+}
+
+func Test_Netlink_Client(t *testing.T) {
+	k := newFakeKernel()
+	c := NewClient(k.backend())
+
+	s, err := c.New("foo", HashIpPort, Timeout(0), HashSize(1024), MaxElem(65536))
+	require.Nil(t, err)
+	require.Nil(t, s.Add("1.1.1.1,udp:53"))
+
+	ok, err := s.Test("1.1.1.1,udp:53")
+	require.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.Test("1.1.1.1,tcp:53")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	info, err := s.List()
+	require.Nil(t, err)
+	assert.Equal(t, "family inet hashsize 1024 maxelem 65536", info.Header)
+	assert.Equal(t, []string{"1.1.1.1,udp:53"}, info.Entries)
+
+	bar, err := c.New("bar", HashIp, Bucketsize(4), Initval(0x5ad1a5b2), Bitmask("255.255.0.0"))
+	require.Nil(t, err)
+	info, err = bar.List()
+	require.Nil(t, err)
+	assert.Equal(t, "family inet hashsize 0 maxelem 0 bitmask 255.255.0.0 bucketsize 4 initval 0x5ad1a5b2", info.Header)
+	_, err = c.New("baz", HashIp, Family(Inet6), Bitmask("255.255.0.0"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Syntax error: invalid bitmask value")
+
+	err = c.Swap("foo", "bar")
+	require.Error(t, err)
+	assert.Equal(t, "ipset: can't swap from foo to bar: The sets cannot be swapped: their type does not match\n", err.Error())
+
+	s, err = c.Open("foo")
+	require.Nil(t, err)
+	assert.Equal(t, HashIpPort, s.(*set).setType)
+	_, err = c.Open("baz")
+	assert.True(t, errors.Is(err, ErrSetNotExist))
+
+	out, err := k.backend().Run(context.Background(), nil, _list, "foo", _terse)
+	require.Nil(t, err)
+	assert.NotContains(t, string(out), "Members:")
+
+	names, err := c.ListNames()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"foo", "bar"}, names)
+	infos, err := c.ListAll(TypeFilter(HashIp))
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "bar", infos[0].Name)
+
+	require.Nil(t, c.Flush())
+	require.Nil(t, c.Destroy("foo", "bar"))
+	assert.Len(t, k.sets, 0)
+}
+
+func Test_Netlink_ReusedBuffer(t *testing.T) {
+	k := newFakeKernel()
+	c := NewClient(k.sockBackend())
+
+	foo, err := c.New("foo", HashIp)
+	require.Nil(t, err)
+	require.Nil(t, foo.Add("1.1.1.1"))
+	bar, err := c.New("bar", HashNet)
+	require.Nil(t, err)
+	require.Nil(t, bar.Add("10.0.0.0/8"))
+
+	info, err := foo.List()
+	require.Nil(t, err)
+	assert.Equal(t, HashIp, info.SetType)
+	assert.Equal(t, []string{"1.1.1.1"}, info.Entries)
+
+	infos, err := c.ListAll()
+	require.Nil(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "foo", infos[0].Name)
+	assert.Equal(t, []string{"1.1.1.1"}, infos[0].Entries)
+	assert.Equal(t, "bar", infos[1].Name)
+	assert.Equal(t, []string{"10.0.0.0/8"}, infos[1].Entries)
+}
+
+func Test_Netlink_Context(t *testing.T) {
+	k := newFakeKernel()
+	b := k.backend()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := b.Run(ctx, nil, _create, "foo", string(HashIp))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Len(t, k.sets, 0)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	s := &nlSession{ctx: ctx, conn: k, protocol: ipsetProtocolMin, headers: make(map[string]nlHeader)}
+	require.Nil(t, s.exec([]string{_create, "foo", string(HashIp)}))
+	cancel()
+	err = s.restore([]byte("add foo 1.1.1.1\n"))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Len(t, k.sets[0].entries, 0)
+
+	// the members resolved by list are checked one by one
+	r := newNlRequest(0, 0)
+	r.ip(ipsetAttrIP, net.ParseIP("1.1.1.1"))
+	data, err := parseNlAttrs(r.b[nlmsgHdrLen+nfgenmsgLen:])
+	require.Nil(t, err)
+	s.resolve = true
+	err = s.listSet(&nlSet{name: "foo", header: nlHeader{setType: HashIp}, entries: []nlAttrs{data}})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "1.1.1.1", formatEntry(ctx, HashIp, data, true))
+}
+
+func Test_Netlink_Entry(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		setType SetType
+		family  uint8
+		entry   string
+		want    string
+	}{
+		{BitmapIp, nfprotoIPv4, "192.168.1.1", ""},
+		{BitmapIp, nfprotoIPv4, "192.168.1/24", "192.168.0.1/24"},
+		{BitmapIpMac, nfprotoIPv4, "192.168.1.1,12:34:56:78:9a:bc", "192.168.1.1,12:34:56:78:9A:BC"},
+		{BitmapPort, nfprotoUnspec, "80", ""},
+		{HashIp, nfprotoIPv4, "1.1.1.1", ""},
+		{HashIp, nfprotoIPv6, "2001:db8::1", ""},
+		{HashMac, nfprotoUnspec, "01:02:03:04:05:06", ""},
+		{HashIpMac, nfprotoIPv4, "1.1.1.1,01:02:03:04:05:06", ""},
+		{HashNet, nfprotoIPv4, "10.0.0.0/8", ""},
+		{HashNet, nfprotoIPv4, "10.0.0.1/32", "10.0.0.1"},
+		{HashNetNet, nfprotoIPv4, "10.0.0.0/8,192.168.0.0/16", ""},
+		{HashIpPort, nfprotoIPv4, "1.1.1.1,80", "1.1.1.1,tcp:80"},
+		{HashIpPort, nfprotoIPv4, "1.1.1.1,icmp:8/0", ""},
+		{HashNetPort, nfprotoIPv4, "10.0.0.0/8,udp:53", ""},
+		{HashIpPortIp, nfprotoIPv4, "1.1.1.1,sctp:80,2.2.2.2", ""},
+		{HashIpPortNet, nfprotoIPv4, "1.1.1.1,tcp:80,10.0.0.0/8", ""},
+		{HashIpMark, nfprotoIPv4, "1.1.1.1,0x10", "1.1.1.1,0x00000010"},
+		{HashNetPortNet, nfprotoIPv4, "10.0.0.0/8,tcp:80,10.0.0.0/24", ""},
+		{HashNetIface, nfprotoIPv4, "10.0.0.0/8,physdev:eth0", ""},
+		{HashNetIface, nfprotoIPv4, "10.0.0.0/8,eth0", ""},
+		{ListSet, nfprotoUnspec, "foo", ""},
+	}
+
+	for _, tc := range tt {
+		r := newNlRequest(ipsetCmdAdd, tc.family)
+		flags, err := encodeEntry(context.Background(), r, tc.setType, tc.family, tc.entry)
+		require.Nil(t, err, tc.entry)
+		require.Nil(t, encodeEntryOptions(r, flags, nil))
+		data, err := parseNlAttrs(r.b[nlmsgHdrLen+nfgenmsgLen:])
+		require.Nil(t, err)
+
+		want := tc.want
+		if want == "" {
+			want = tc.entry
+		}
+		assert.Equal(t, want, formatEntry(context.Background(), tc.setType, data, false), tc.entry)
+	}
+}
+
+func Test_Netlink_EntryOptions(t *testing.T) {
+	t.Parallel()
+
+	r := newNlRequest(ipsetCmdAdd, nfprotoIPv4)
+	require.Nil(t, encodeEntryOptions(r, 0, []string{
+		_timeout, "60", _packets, "1", _bytes, "2", _comment, "c",
+		_skbmark, "0x1111/0xff00ffff", _skbprio, "1:10", _skbqueue, "10", _nomatch,
+	}))
+	data, err := parseNlAttrs(r.b[nlmsgHdrLen+nfgenmsgLen:])
+	require.Nil(t, err)
+	assert.Equal(t,
+		` timeout 60 packets 1 bytes 2 comment "c" skbmark 0x1111/0xff00ffff skbprio 1:10 skbqueue 10 nomatch`,
+		formatEntry(context.Background(), ListSet, data, false))
+
+	for _, opts := range [][]string{{"unknown"}, {_timeout}, {_timeout, "x"}, {_skbprio, "1"}} {
+		err := encodeEntryOptions(newNlRequest(0, 0), 0, opts)
+		assert.Error(t, err, strings.Join(opts, " "))
+	}
+}
+
+func Test_Netlink_Errors(t *testing.T) {
+	t.Parallel()
+
+	s := &nlSession{}
+	assert.Equal(t, "Hash is full, cannot add more elements",
+		s.error(ipsetCmdAdd, "hash", nlError(ipsetErrTypeSpecific)).Error())
+	assert.Equal(t, "Element is out of the range of the set",
+		s.error(ipsetCmdAdd, "bitmap", nlError(ipsetErrTypeSpecific)).Error())
+	assert.Equal(t, "Set cannot be destroyed: it is in use by a kernel component",
+		s.error(ipsetCmdDestroy, "", nlError(ipsetErrBusy)).Error())
+	assert.Equal(t, "Kernel error received: operation not permitted",
+		s.error(ipsetCmdCreate, "", nlError(1)).Error())
+	assert.Equal(t, "other", s.error(ipsetCmdCreate, "", fmt.Errorf("other")).Error())
+}
+
+func Test_ParseShortIPv4(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		s  string
+		ip string
+	}{
+		{"192.168.1", "192.168.0.1"},
+		{"192.168.256", "192.168.1.0"},
+		{"10.1", "10.0.0.1"},
+		{"10", "<nil>"},
+		{"10.256.1", "<nil>"},
+		{"a.b.c", "<nil>"},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.ip, parseShortIPv4(tc.s).String(), tc.s)
+	}
+}
@@ -0,0 +1,68 @@
+package ipset
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// sysSetns is the number of the setns syscall, which the syscall
+// package lacks on some architectures.
+var sysSetns = map[string]uintptr{
+	"386": 346, "amd64": 308, "arm": 375, "arm64": 268,
+	"loong64": 268, "mips": 4344, "mipsle": 4344, "mips64": 5303,
+	"mips64le": 5303, "ppc64": 350, "ppc64le": 350, "riscv64": 268,
+	"s390x": 339,
+}[runtime.GOARCH]
+
+// inNetNS calls fn on a dedicated goroutine whose os thread is
+// locked and switched to the network namespace at path, so that
+// the processes forked and the sockets opened by fn belong to it.
+// The thread is switched back after fn returns. If that fails, the
+// goroutine exits with the thread still locked, so that the runtime
+// terminates the thread instead of reusing it.
+func inNetNS(path string, fn func()) error {
+	ns, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't open network namespace: %w", err)
+	}
+	defer func() { _ = ns.Close() }()
+
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			done <- fmt.Errorf("can't open network namespace: %w", err)
+			return
+		}
+		defer func() { _ = origin.Close() }()
+
+		if err = setns(ns.Fd()); err != nil {
+			runtime.UnlockOSThread()
+			done <- fmt.Errorf("can't enter network namespace %s: %w", path, err)
+			return
+		}
+		fn()
+		if err = setns(origin.Fd()); err != nil {
+			done <- fmt.Errorf("can't leave network namespace %s: %w", path, err)
+			return
+		}
+		runtime.UnlockOSThread()
+		done <- nil
+	}()
+	return <-done
+}
+
+func setns(fd uintptr) error {
+	if sysSetns == 0 {
+		return fmt.Errorf("setns is not supported on %s", runtime.GOARCH)
+	}
+	_, _, errno := syscall.RawSyscall(sysSetns, fd, syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return os.NewSyscallError("setns", errno)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package ipset
+
+import "errors"
+
+func inNetNS(path string, fn func()) error {
+	return errors.New("network namespaces are only supported on linux")
+}
@@ -23,14 +23,19 @@ type options struct {
 	skbqueue        uint
 	hashSize        uint
 	maxElem         uint
+	bucketsize      uint
+	initval         uint32
 	family          NetFamily
 	nomatch         bool
 	forceadd        bool
 	ipRange         string
 	portRange       string
 	netmask         byte
+	bitmask         string
 	markmask        uint32
+	markmaskSet     bool
 	listSize        uint
+	strict          bool
 }
 
 func (o *options) apply(opts ...Option) *options {
@@ -65,12 +70,17 @@ func releaseOptions(o *options) {
 	o.skbqueue = 0
 	o.hashSize = 0
 	o.maxElem = 0
+	o.bucketsize = 0
+	o.initval = 0
 	o.family = ""
 	o.nomatch = false
 	o.forceadd = false
 	o.netmask = 0
+	o.bitmask = ""
 	o.markmask = 0
+	o.markmaskSet = false
 	o.listSize = 0
+	o.strict = false
 	o.ipRange = ""
 	o.portRange = ""
 	optionsPool.Put(o)
@@ -274,6 +284,31 @@ func MaxElem(maxElem uint) Option {
 	}
 }
 
+// Bucketsize option is valid for the create command of all
+// hash type sets. It defines the maximal number of elements
+// which can be stored in a bucket of the hash, the value must
+// be between 2-12, default is 12. It requires ipset v7.10 or
+// later. Example:
+//
+//      ipset create test hash:ip bucketsize 2
+func Bucketsize(bucketsize uint) Option {
+	return func(opt *options) {
+		opt.bucketsize = bucketsize
+	}
+}
+
+// Initval option is valid for the create command of all hash
+// type sets. It defines the initial value of the hash function
+// instead of a random one, so that a set can be recreated with
+// the same hash. It requires ipset v7.10 or later. Example:
+//
+//      ipset create test hash:ip initval 0x5ad1a5b2
+func Initval(initval uint32) Option {
+	return func(opt *options) {
+		opt.initval = initval
+	}
+}
+
 // NetFamily defines the protocol family of the IP addresses
 type NetFamily string
 
@@ -337,13 +372,26 @@ func Forceadd(forceadd bool) Option {
 // Netmask option is for ip datatype. Network addresses will be
 // stored in the set instead of IP host addresses. The cidr
 // prefix value must be between 1-32 for IPv4 and between 1-128
-// for IPv6.
+// for IPv6. It's valid for BitmapIp and HashIp, and for
+// HashIpPort and HashNetNet with ipset v7.17 or later.
 func Netmask(netmask byte) Option {
 	return func(opt *options) {
 		opt.netmask = netmask
 	}
 }
 
+// Bitmask option is like Netmask but the mask is an address,
+// so that any bits of the IP addresses can be masked out. It's
+// valid for HashIp, HashIpPort and HashNetNet, can't be given
+// with Netmask and requires ipset v7.17 or later. Example:
+//
+//      ipset create test hash:ip bitmask 255.0.255.0
+func Bitmask(bitmask string) Option {
+	return func(opt *options) {
+		opt.bitmask = bitmask
+	}
+}
+
 // Markmask option is for HashIpMark set type. It allows you to
 // set bits you are interested in the packet mark. This values is
 // then used to perform bitwise AND operation for every mark
@@ -351,7 +399,7 @@ func Netmask(netmask byte) Option {
 // default all 32 bits are set.
 func Markmask(markmask uint32) Option {
 	return func(opt *options) {
-		opt.markmask = markmask
+		opt.markmask, opt.markmaskSet = markmask, true
 	}
 }
 
@@ -380,3 +428,18 @@ func PortRange(portRange string) Option {
 		opt.portRange = portRange
 	}
 }
+
+// Strict option makes the command fail with an error wrapping
+// ErrInvalidOption instead of ignoring the options which are not
+// valid for the command or the set type, i.e. Netmask of HashNet
+// or Skbmark of create. The values of the options are checked as
+// well: the netmask must be between 1-32 for IPv4 and 1-128 for
+// IPv6, the bitmask must be an address of the family and can't be
+// given with netmask, the hashsize must be a power of two, the
+// bucketsize must be between 2-12, the markmask must be non-zero
+// and the timeout can't exceed 2147483 seconds.
+func Strict(strict bool) Option {
+	return func(opt *options) {
+		opt.strict = strict
+	}
+}
@@ -0,0 +1,169 @@
+package ipset
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// TypeSupport tells whether the running kernel can create sets of
+// a set type.
+type TypeSupport struct {
+	// Module is the kernel module of the set type, i.e.
+	// ip_set_hash_ip.
+	Module string
+	// Loaded is true if the module is loaded or built in.
+	Loaded bool
+	// Available is true if the module is loaded, built in or
+	// can be loaded on demand when a set is created.
+	Available bool
+	// Revisions are the revisions kernel supports, they're nil
+	// unless the Prober has a Client.
+	Revisions *Revisions
+}
+
+// Prober probes the set types the running kernel can create from
+// the kernel modules. The loaded modules are read from
+// /proc/modules, the built in and loadable ones from
+// modules.builtin and modules.dep of /lib/modules/<release>, where
+// the release is read from /proc/sys/kernel/osrelease. The
+// modules are checked in /sys/module as well if /proc/modules
+// can't be read, i.e. in some containers.
+type Prober struct {
+	// ReadFile reads the files above, ioutil.ReadFile is used if
+	// it's nil. It can be replaced to probe without root, i.e.
+	// in tests.
+	ReadFile func(name string) ([]byte, error)
+
+	// Client, if not nil, queries the revisions of the set types
+	// from kernel, the types kernel answers are available. It
+	// requires the netlink backend and CAP_NET_ADMIN, i.e.
+	//      NewClient(NewNetlinkBackend())
+	Client *Client
+}
+
+// ProbeTypes probes all set types with the default Prober, see
+// Prober.
+func ProbeTypes() (map[SetType]TypeSupport, error) {
+	return (&Prober{}).Probe()
+}
+
+// Supported checks whether the running kernel can create sets of
+// the set type, see ProbeTypes.
+func (t SetType) Supported() bool {
+	types, err := ProbeTypes()
+	return err == nil && types[t].Available
+}
+
+// Probe returns the support of all set types. The set types are
+// not available if none of the files can be read, and an error is
+// returned only if the Client fails.
+func (p *Prober) Probe() (map[SetType]TypeSupport, error) {
+	loaded := p.loaded()
+	builtin, loadable := p.installed()
+
+	var revisions map[SetType]Revisions
+	if p.Client != nil {
+		v, err := p.Client.Version()
+		if err != nil {
+			return nil, err
+		}
+		revisions = v.Types
+	}
+
+	// the core module is required by all set types
+	core := loaded[ipsetModule] || builtin[ipsetModule] || loadable[ipsetModule]
+	types := make(map[SetType]TypeSupport, len(setTypes))
+	for _, setType := range setTypes {
+		m := setType.module()
+		s := TypeSupport{Module: m, Loaded: loaded[m] || builtin[m]}
+		s.Available = core && (s.Loaded || loadable[m])
+		if r, ok := revisions[setType]; ok {
+			s.Available, s.Revisions = true, &r
+		}
+		types[setType] = s
+	}
+	return types, nil
+}
+
+const ipsetModule = "ip_set"
+
+// module returns the kernel module of the set type, i.e.
+// ip_set_hash_netportnet of hash:net,port,net.
+func (t SetType) module() string {
+	return ipsetModule + "_" + strings.Replace(strings.Replace(string(t), ":", "_", 1), ",", "", -1)
+}
+
+func (p *Prober) readFile(name string) ([]byte, error) {
+	if p.ReadFile != nil {
+		return p.ReadFile(name)
+	}
+	return ioutil.ReadFile(name)
+}
+
+// loaded returns the loaded modules.
+func (p *Prober) loaded() map[string]bool {
+	modules := make(map[string]bool)
+	b, err := p.readFile("/proc/modules")
+	if err != nil {
+		for _, m := range append([]string{ipsetModule}, typeModules()...) {
+			state, err := p.readFile("/sys/module/" + m + "/initstate")
+			if err == nil && strings.TrimSpace(string(state)) == "live" {
+				modules[m] = true
+			}
+		}
+		return modules
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if fields := strings.Fields(s.Text()); len(fields) > 0 {
+			modules[fields[0]] = true
+		}
+	}
+	return modules
+}
+
+// installed returns the built in and loadable modules of the
+// running kernel, they're empty if the files are missing.
+func (p *Prober) installed() (builtin, loadable map[string]bool) {
+	builtin, loadable = make(map[string]bool), make(map[string]bool)
+	release, err := p.readFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return
+	}
+	dir := path.Join("/lib/modules", strings.TrimSpace(string(release)))
+
+	for file, modules := range map[string]map[string]bool{
+		"modules.builtin": builtin,
+		"modules.dep":     loadable,
+	} {
+		b, err := p.readFile(path.Join(dir, file))
+		if err != nil {
+			continue
+		}
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			// i.e. kernel/net/netfilter/ipset/ip_set_hash_ip.ko.xz: kernel/...
+			line := s.Text()
+			if i := strings.IndexByte(line, ':'); i != -1 {
+				line = line[:i]
+			}
+			name := path.Base(strings.TrimSpace(line))
+			if i := strings.Index(name, ".ko"); i != -1 {
+				modules[strings.Replace(name[:i], "-", "_", -1)] = true
+			}
+		}
+	}
+	return
+}
+
+func typeModules() []string {
+	modules := make([]string, len(setTypes))
+	for i, setType := range setTypes {
+		modules[i] = setType.module()
+	}
+	return modules
+}
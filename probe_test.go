@@ -0,0 +1,80 @@
+package ipset
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFiles reads the files from the map.
+func fakeFiles(files map[string]string) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		if s, ok := files[name]; ok {
+			return []byte(s), nil
+		}
+		return nil, os.ErrNotExist
+	}
+}
+
+func Test_Prober(t *testing.T) {
+	t.Parallel()
+
+	t.Run("modules", func(t *testing.T) {
+		p := &Prober{ReadFile: fakeFiles(map[string]string{
+			"/proc/modules": "ip_set_hash_ip 45056 1 - Live 0x0000000000000000\n" +
+				"ip_set 57344 1 ip_set_hash_ip, Live 0x0000000000000000\n",
+			"/proc/sys/kernel/osrelease":                     "5.15.0-91-generic\n",
+			"/lib/modules/5.15.0-91-generic/modules.builtin": "kernel/net/netfilter/ipset/ip_set_list_set.ko\n",
+			"/lib/modules/5.15.0-91-generic/modules.dep": "kernel/net/netfilter/ipset/ip_set_hash_netportnet.ko.zst: kernel/net/netfilter/ipset/ip_set.ko.zst\n" +
+				"kernel/net/netfilter/ipset/ip_set.ko.zst: kernel/net/netfilter/nfnetlink.ko.zst\n",
+		})}
+		types, err := p.Probe()
+		require.Nil(t, err)
+		require.Len(t, types, len(setTypes))
+		assert.Equal(t, TypeSupport{Module: "ip_set_hash_ip", Loaded: true, Available: true}, types[HashIp])
+		assert.Equal(t, TypeSupport{Module: "ip_set_list_set", Loaded: true, Available: true}, types[ListSet])
+		assert.Equal(t, TypeSupport{Module: "ip_set_hash_netportnet", Available: true}, types[HashNetPortNet])
+		assert.Equal(t, TypeSupport{Module: "ip_set_bitmap_ipmac"}, types[BitmapIpMac])
+	})
+
+	t.Run("sysfs", func(t *testing.T) {
+		p := &Prober{ReadFile: fakeFiles(map[string]string{
+			"/sys/module/ip_set/initstate":          "live\n",
+			"/sys/module/ip_set_hash_net/initstate": "live\n",
+			"/sys/module/ip_set_hash_mac/initstate": "coming\n",
+		})}
+		types, err := p.Probe()
+		require.Nil(t, err)
+		assert.True(t, types[HashNet].Available)
+		assert.False(t, types[HashMac].Available)
+	})
+
+	t.Run("no core", func(t *testing.T) {
+		p := &Prober{ReadFile: fakeFiles(map[string]string{
+			"/proc/modules": "ip_set_hash_ip 45056 1 - Live 0x0000000000000000\n",
+		})}
+		types, err := p.Probe()
+		require.Nil(t, err)
+		assert.True(t, types[HashIp].Loaded)
+		assert.False(t, types[HashIp].Available)
+	})
+
+	t.Run("revisions", func(t *testing.T) {
+		k := newFakeKernel()
+		k.missing = map[string]bool{string(HashIpMark): true}
+		p := &Prober{ReadFile: fakeFiles(nil), Client: NewClient(k.backend())}
+		types, err := p.Probe()
+		require.Nil(t, err)
+		assert.Equal(t, &Revisions{0, 4}, types[HashIp].Revisions)
+		assert.True(t, types[HashIp].Available)
+		assert.Nil(t, types[HashIpMark].Revisions)
+		assert.False(t, types[HashIpMark].Available)
+
+		p.Client = NewClient(&fakeBackend{err: errors.New("exit")})
+		_, err = p.Probe()
+		assert.Error(t, err)
+	})
+}
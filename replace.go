@@ -0,0 +1,55 @@
+package ipset
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// tmpSuffix followed by random hex digits is appended to the name
+// of the temporary set used by Replace.
+const (
+	tmpSuffix = "-tmp"
+	tmpRandom = 4
+)
+
+func (s set) Replace(entries []string, options ...Option) error {
+	return s.ReplaceContext(context.Background(), entries, options...)
+}
+
+func (s set) ReplaceContext(ctx context.Context, entries []string, options ...Option) (err error) {
+	info, err := s.client.info(ctx, s.name)
+	if err != nil {
+		return err
+	}
+
+	tmp := tmpName(s.name)
+	t, err := s.client.NewContext(ctx, tmp, info.SetType, info.SetHeader.Options()...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the temporary set is destroyed even if ctx is done
+		if e := s.client.destroy(context.Background(), tmp); err == nil {
+			err = e
+		}
+	}()
+
+	if err = t.AddManyContext(ctx, entries, options...); err != nil {
+		return err
+	}
+	return s.client.SwapContext(ctx, tmp, s.name)
+}
+
+// tmpName returns a name of a temporary set of name which is
+// unique per call, so that neither concurrent calls nor a set of
+// the user clash with it. name is truncated to fit the max length
+// of set names.
+func tmpName(name string) string {
+	if max := ipsetMaxNameLen - 1 - len(tmpSuffix) - 2*tmpRandom; len(name) > max {
+		name = name[:max]
+	}
+	b := make([]byte, tmpRandom)
+	_, _ = rand.Read(b)
+	return name + tmpSuffix + hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package ipset
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Set_Replace(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		k := newFakeKernel()
+		c := NewClient(k.backend())
+		s, err := c.New("foo", HashIp, Timeout(time.Hour), HashSize(2048), Comment(true))
+		require.Nil(t, err)
+		require.Nil(t, s.Add("1.1.1.1"))
+		// a set of the user isn't touched
+		_, err = c.New("foo-tmp", HashIp)
+		require.Nil(t, err)
+
+		require.Nil(t, s.Replace([]string{"2.2.2.2", "3.3.3.3"}, CommentContent("x")))
+
+		names, err := c.ListNames()
+		require.Nil(t, err)
+		assert.Equal(t, []string{"foo-tmp", "foo"}, names)
+		info, err := s.List()
+		require.Nil(t, err)
+		assert.Equal(t, "family inet hashsize 2048 maxelem 0 timeout 3600 comment", info.Header)
+		assert.Equal(t, []string{`2.2.2.2 comment "x"`, `3.3.3.3 comment "x"`}, info.Entries)
+	})
+
+	t.Run("cleanup", func(t *testing.T) {
+		k := newFakeKernel()
+		c := NewClient(k.backend())
+		s, err := c.New("foo", HashIp)
+		require.Nil(t, err)
+		require.Nil(t, s.Add("1.1.1.1"))
+
+		err = s.Replace([]string{"2.2.2.2", "2.2.2.2"})
+		var batchErr *BatchError
+		require.True(t, errors.As(err, &batchErr))
+
+		names, err := c.ListNames()
+		require.Nil(t, err)
+		assert.Equal(t, []string{"foo"}, names)
+		info, err := s.List()
+		require.Nil(t, err)
+		assert.Equal(t, []string{"1.1.1.1"}, info.Entries)
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		c := NewClient(newFakeKernel().backend())
+		err := (&set{"foo", HashIp, c, nil}).Replace([]string{"1.1.1.1"})
+		assert.True(t, errors.Is(err, ErrSetNotExist))
+	})
+}
+
+func Test_TmpName(t *testing.T) {
+	t.Parallel()
+
+	name := tmpName("foo")
+	assert.True(t, strings.HasPrefix(name, "foo"+tmpSuffix))
+	assert.Len(t, name, len("foo"+tmpSuffix)+2*tmpRandom)
+	assert.NotEqual(t, name, tmpName("foo"))
+
+	long := strings.Repeat("a", 31)
+	name = tmpName(long)
+	assert.Len(t, name, 31)
+	assert.NotEqual(t, name, tmpName(long))
+}
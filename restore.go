@@ -0,0 +1,134 @@
+package ipset
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gonetx/ipset/savefile"
+)
+
+// RestoreError is returned by RestoreAll if ipset fails at a
+// line of the input.
+type RestoreError struct {
+	// Line is the line number of the input starting from 1.
+	Line int
+	// Err describes the failed command of the line.
+	Err *OpError
+}
+
+func (e *RestoreError) Error() string {
+	return "ipset: line " + strconv.Itoa(e.Line) + ": " + strings.TrimPrefix(e.Err.Error(), "ipset: ")
+}
+
+func (e *RestoreError) Unwrap() error {
+	return e.Err
+}
+
+// RestoreAll restores the save file read from r, which may create
+// and fill any number of sets. Only the Exist option is used.
+func (c *Client) RestoreAll(r io.Reader, options ...Option) error {
+	return c.RestoreAllContext(context.Background(), r, options...)
+}
+
+// RestoreAllContext is like RestoreAll but aborts as soon as ctx
+// is done.
+func (c *Client) RestoreAllContext(ctx context.Context, r io.Reader, options ...Option) error {
+	var (
+		lines []int
+		args  [][]string
+		b     = &bytes.Buffer{}
+		p     = savefile.NewParser(r)
+	)
+	for {
+		cmd, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("ipset: can't restore: %w", err)
+		}
+
+		var line string
+		if err = validateCommand(cmd); err == nil {
+			line, err = savefile.Format(cmd)
+		}
+		if err != nil {
+			return fmt.Errorf("ipset: can't restore: line %d: %s", p.Line(), err)
+		}
+		// savefile formats valid lines only
+		a, _ := savefile.Split(line)
+		lines = append(lines, p.Line())
+		args = append(args, a)
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	o := acquireOptions().apply(options...)
+	exist := o.exist
+	releaseOptions(o)
+
+	restoreArgs := []string{_restore}
+	if exist {
+		restoreArgs = append(restoreArgs, _exist)
+	}
+	_, err := run(ctx, c.backend, "restore", b.Bytes(), restoreArgs...)
+	n, msg := failedLine(err)
+	if n < 1 || n > len(lines) {
+		return err
+	}
+
+	// the ipset restore sees the canonical lines only, so the
+	// line number is mapped back to the input
+	a := args[n-1]
+	e := &OpError{
+		Action: a[0],
+		Args:   a,
+		Output: msg,
+		Err:    classify([]byte(msg)),
+		op:     strings.Join(a, " "),
+	}
+	if len(a) > 1 {
+		e.Set = a[1]
+	}
+	if len(a) > 2 && (e.Action == _add || e.Action == _del) {
+		e.Entry = a[2]
+	}
+	if e.Err == nil {
+		e.Err = errors.New(strings.TrimSpace(msg))
+	}
+	return &RestoreError{Line: lines[n-1], Err: e}
+}
+
+// validateCommand checks the set names and types of cmd.
+func validateCommand(cmd savefile.Command) error {
+	var names []string
+	switch c := cmd.(type) {
+	case *savefile.CreateCommand:
+		if !SetType(c.Type).valid() {
+			return fmt.Errorf("unknown type %q", c.Type)
+		}
+		names = []string{c.Set}
+	case *savefile.AddCommand:
+		names = []string{c.Set}
+	case *savefile.DelCommand:
+		names = []string{c.Set}
+	case *savefile.RenameCommand:
+		names = []string{c.From, c.To}
+	case *savefile.SwapCommand:
+		names = []string{c.From, c.To}
+	}
+	for _, name := range names {
+		if name == "" || len(name) >= ipsetMaxNameLen {
+			return fmt.Errorf("invalid set name %q", name)
+		}
+	}
+	return nil
+}
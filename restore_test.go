@@ -0,0 +1,79 @@
+package ipset
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gonetx/ipset/savefile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Client_RestoreAll(t *testing.T) {
+	t.Parallel()
+
+	t.Run("lines", func(t *testing.T) {
+		b := &fakeBackend{}
+		c := NewClient(b)
+
+		require.Nil(t, c.RestoreAll(strings.NewReader(
+			"# saved\ncreate foo hash:ip  comment\n\nadd foo 1.1.1.1 comment \"a b\"\nCOMMIT\n"), Exist(true)))
+		assert.Equal(t, [][]string{{_restore, _exist}}, b.args)
+		assert.Equal(t, "create foo hash:ip comment\nadd foo 1.1.1.1 comment \"a b\"\nCOMMIT\n", string(b.stdin[0]))
+
+		require.Nil(t, c.RestoreAll(strings.NewReader("\n# nothing\n")))
+		assert.Len(t, b.args, 1)
+	})
+
+	t.Run("multiple sets", func(t *testing.T) {
+		k := newFakeKernel()
+		c := NewClient(k.backend())
+
+		require.Nil(t, c.RestoreAll(strings.NewReader(
+			"create foo hash:ip\nadd foo 1.1.1.1\ncreate bar hash:ip\nadd bar 2.2.2.2\nswap foo bar\n")))
+		names, err := c.ListNames()
+		require.Nil(t, err)
+		assert.ElementsMatch(t, []string{"foo", "bar"}, names)
+
+		s, err := c.Open("foo")
+		require.Nil(t, err)
+		info, err := s.List()
+		require.Nil(t, err)
+		assert.Equal(t, HashIp, info.SetType)
+		assert.Equal(t, []string{"2.2.2.2"}, info.Entries)
+	})
+
+	t.Run("failed line", func(t *testing.T) {
+		k := newFakeKernel()
+		c := NewClient(k.backend())
+
+		err := c.RestoreAll(strings.NewReader(
+			"# saved\n\ncreate foo hash:ip\nadd foo 1.1.1.1\n\nadd foo 1.1.1.1\n"))
+		var e *RestoreError
+		require.True(t, errors.As(err, &e))
+		assert.Equal(t, 6, e.Line)
+		assert.Equal(t, "foo", e.Err.Set)
+		assert.Equal(t, "1.1.1.1", e.Err.Entry)
+		assert.True(t, errors.Is(err, ErrEntryExists))
+		assert.Equal(t, "ipset: line 6: can't add foo 1.1.1.1: Element cannot be added to the set: "+
+			"it's already added", err.Error())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		b := &fakeBackend{}
+		c := NewClient(b)
+
+		err := c.RestoreAll(strings.NewReader("create foo hash:ip\nlist foo\n"))
+		var se *savefile.SyntaxError
+		require.True(t, errors.As(err, &se))
+		assert.Equal(t, 2, se.Line)
+
+		err = c.RestoreAll(strings.NewReader("create foo hash:unknown\n"))
+		assert.Equal(t, `ipset: can't restore: line 1: unknown type "hash:unknown"`, err.Error())
+
+		err = c.RestoreAll(strings.NewReader("add " + strings.Repeat("a", 32) + " 1.1.1.1\n"))
+		assert.NotNil(t, err)
+		assert.Len(t, b.args, 0)
+	})
+}
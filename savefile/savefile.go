@@ -0,0 +1,391 @@
+// Package savefile parses and writes the file format of ipset
+// save and restore, i.e.
+//
+//      create foo hash:ip family inet hashsize 1024 maxelem 65536 comment
+//      add foo 1.1.1.1 comment "one"
+//      COMMIT
+//
+// Every line is a typed Command, so a save file can be inspected,
+// transformed and generated without string hacks.
+package savefile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Commands of save file
+const (
+	Create  = "create"
+	Add     = "add"
+	Del     = "del"
+	Flush   = "flush"
+	Destroy = "destroy"
+	Rename  = "rename"
+	Swap    = "swap"
+	Commit  = "COMMIT"
+)
+
+// createOptions and addOptions are the options of create and
+// add, the value is true if the option takes a value.
+var (
+	createOptions = map[string]bool{
+		"family": true, "hashsize": true, "maxelem": true, "netmask": true,
+		"markmask": true, "range": true, "size": true, "timeout": true,
+		"bucketsize": true, "initval": true, "bitmask": true,
+		"counters": false, "comment": false, "skbinfo": false, "forceadd": false,
+	}
+	addOptions = map[string]bool{
+		"timeout": true, "packets": true, "bytes": true, "comment": true,
+		"skbmark": true, "skbprio": true, "skbqueue": true,
+		"before": true, "after": true, "nomatch": false,
+	}
+)
+
+// Option is an option of create or add. Value is empty if the
+// option is a flag, i.e. counters.
+type Option struct {
+	Name  string
+	Value string
+}
+
+// Options are the options of a command in order.
+type Options []Option
+
+// Get returns the value of the named option and whether it's
+// present.
+func (opts Options) Get(name string) (string, bool) {
+	for _, opt := range opts {
+		if opt.Name == name {
+			return opt.Value, true
+		}
+	}
+	return "", false
+}
+
+// Command is a line of save file, one of *CreateCommand,
+// *AddCommand, *DelCommand, *FlushCommand, *DestroyCommand,
+// *RenameCommand, *SwapCommand and *CommitCommand.
+type Command interface {
+	// Action returns the command name, i.e. create.
+	Action() string
+
+	args() ([]string, error)
+}
+
+// CreateCommand creates a set.
+type CreateCommand struct {
+	Set     string
+	Type    string
+	Options Options
+}
+
+// AddCommand adds an entry to a set.
+type AddCommand struct {
+	Set     string
+	Entry   string
+	Options Options
+}
+
+// DelCommand deletes an entry from a set.
+type DelCommand struct {
+	Set   string
+	Entry string
+}
+
+// FlushCommand flushes a set, or all sets if Set is empty.
+type FlushCommand struct {
+	Set string
+}
+
+// DestroyCommand destroys a set, or all sets if Set is empty.
+type DestroyCommand struct {
+	Set string
+}
+
+// RenameCommand renames set From to To.
+type RenameCommand struct {
+	From string
+	To   string
+}
+
+// SwapCommand swaps the content of set From and To.
+type SwapCommand struct {
+	From string
+	To   string
+}
+
+// CommitCommand ends a restore session.
+type CommitCommand struct{}
+
+func (*CreateCommand) Action() string  { return Create }
+func (*AddCommand) Action() string     { return Add }
+func (*DelCommand) Action() string     { return Del }
+func (*FlushCommand) Action() string   { return Flush }
+func (*DestroyCommand) Action() string { return Destroy }
+func (*RenameCommand) Action() string  { return Rename }
+func (*SwapCommand) Action() string    { return Swap }
+func (*CommitCommand) Action() string  { return Commit }
+
+func (c *CreateCommand) args() ([]string, error) {
+	return appendOptions([]string{Create, c.Set, c.Type}, c.Options, createOptions)
+}
+
+func (c *AddCommand) args() ([]string, error) {
+	return appendOptions([]string{Add, c.Set, c.Entry}, c.Options, addOptions)
+}
+
+func (c *DelCommand) args() ([]string, error) {
+	return []string{Del, c.Set, c.Entry}, nil
+}
+
+func (c *FlushCommand) args() ([]string, error) {
+	return optional(Flush, c.Set), nil
+}
+
+func (c *DestroyCommand) args() ([]string, error) {
+	return optional(Destroy, c.Set), nil
+}
+
+func (c *RenameCommand) args() ([]string, error) {
+	return []string{Rename, c.From, c.To}, nil
+}
+
+func (c *SwapCommand) args() ([]string, error) {
+	return []string{Swap, c.From, c.To}, nil
+}
+
+func (c *CommitCommand) args() ([]string, error) {
+	return []string{Commit}, nil
+}
+
+func optional(action, set string) []string {
+	if set == "" {
+		return []string{action}
+	}
+	return []string{action, set}
+}
+
+func appendOptions(args []string, opts Options, known map[string]bool) ([]string, error) {
+	for _, opt := range opts {
+		withValue, ok := known[opt.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown option %q of %s", opt.Name, args[0])
+		}
+		args = append(args, opt.Name)
+		if withValue {
+			args = append(args, opt.Value)
+		}
+	}
+	return args, nil
+}
+
+// SyntaxError is returned by Parser for an invalid line.
+type SyntaxError struct {
+	// Line is the line number starting from 1.
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("savefile: line %d: %s", e.Line, e.Msg)
+}
+
+// Parser reads commands from a save file one by one.
+type Parser struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+// NewParser returns a parser reading from r.
+func NewParser(r io.Reader) *Parser {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	return &Parser{sc: sc}
+}
+
+// Line returns the line number of the last parsed command.
+func (p *Parser) Line() int {
+	return p.line
+}
+
+// Next returns the next command. Empty lines and comments
+// starting with # are skipped. It returns io.EOF at the end of
+// the save file and a *SyntaxError for an invalid line.
+func (p *Parser) Next() (Command, error) {
+	for p.sc.Scan() {
+		p.line++
+		t := strings.TrimSpace(p.sc.Text())
+		if t == "" || t[0] == '#' {
+			continue
+		}
+
+		cmd, err := parseLine(t)
+		if err != nil {
+			return nil, &SyntaxError{Line: p.line, Msg: err.Error()}
+		}
+		return cmd, nil
+	}
+	if err := p.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// ParseAll parses all commands from r.
+func ParseAll(r io.Reader) ([]Command, error) {
+	var cmds []Command
+	p := NewParser(r)
+	for {
+		cmd, err := p.Next()
+		if err == io.EOF {
+			return cmds, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+}
+
+func parseLine(line string) (Command, error) {
+	args, err := Split(line)
+	if err != nil {
+		return nil, err
+	}
+
+	action, args := args[0], args[1:]
+	want := map[string][2]int{
+		Create: {2, -1}, Add: {2, -1}, Del: {2, 2}, Flush: {0, 1},
+		Destroy: {0, 1}, Rename: {2, 2}, Swap: {2, 2}, Commit: {0, 0},
+	}
+	n, ok := want[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown command %q", action)
+	}
+	if len(args) < n[0] || n[1] != -1 && len(args) > n[1] {
+		return nil, fmt.Errorf("wrong number of arguments of %s", action)
+	}
+
+	switch action {
+	case Create:
+		opts, err := parseOptions(args[2:], createOptions)
+		return &CreateCommand{Set: args[0], Type: args[1], Options: opts}, err
+	case Add:
+		opts, err := parseOptions(args[2:], addOptions)
+		return &AddCommand{Set: args[0], Entry: args[1], Options: opts}, err
+	case Del:
+		return &DelCommand{Set: args[0], Entry: args[1]}, nil
+	case Flush:
+		return &FlushCommand{Set: strings.Join(args, "")}, nil
+	case Destroy:
+		return &DestroyCommand{Set: strings.Join(args, "")}, nil
+	case Rename:
+		return &RenameCommand{From: args[0], To: args[1]}, nil
+	case Swap:
+		return &SwapCommand{From: args[0], To: args[1]}, nil
+	}
+	return &CommitCommand{}, nil
+}
+
+func parseOptions(args []string, known map[string]bool) (opts Options, err error) {
+	for i := 0; i < len(args); i++ {
+		withValue, ok := known[args[i]]
+		if !ok {
+			return nil, fmt.Errorf("unknown option %q", args[i])
+		}
+		opt := Option{Name: args[i]}
+		if withValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("missing value of %s", args[i])
+			}
+			i++
+			opt.Value = args[i]
+		}
+		opts = append(opts, opt)
+	}
+	return
+}
+
+// Split splits a line into arguments the way ipset restore does.
+// Double quoted arguments such as comments may contain spaces.
+func Split(line string) (args []string, err error) {
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] == '"' {
+			i := strings.IndexByte(line[1:], '"')
+			if i == -1 {
+				return nil, errors.New("missing close quote")
+			}
+			args = append(args, line[1:i+1])
+			line = line[i+2:]
+			continue
+		}
+		i := strings.IndexAny(line, " \t")
+		if i == -1 {
+			i = len(line)
+		}
+		args = append(args, line[:i])
+		line = line[i:]
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty line")
+	}
+	return
+}
+
+// Encoder writes commands to a save file.
+type Encoder struct {
+	w *bufio.Writer
+}
+
+// NewEncoder returns an encoder writing to w. Flush must be
+// called after the last command is encoded.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes cmd as a line. Arguments containing spaces are
+// double quoted, and since ipset has no escape character, an
+// argument containing a double quote can't be written.
+func (e *Encoder) Encode(cmd Command) error {
+	line, err := Format(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err = e.w.WriteString(line); err != nil {
+		return err
+	}
+	return e.w.WriteByte('\n')
+}
+
+// Flush writes the buffered lines to the underlying writer.
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// Format returns cmd as a line without the line break.
+func Format(cmd Command) (string, error) {
+	args, err := cmd.args()
+	if err != nil {
+		return "", fmt.Errorf("savefile: %s", err)
+	}
+
+	var b strings.Builder
+	for i, arg := range args {
+		if strings.ContainsRune(arg, '"') {
+			return "", fmt.Errorf("savefile: argument %q of %s contains a double quote", arg, cmd.Action())
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		// comments are always quoted as ipset save does
+		if arg == "" || strings.ContainsAny(arg, " \t") || i > 0 && args[i-1] == "comment" && cmd.Action() == Add {
+			arg = `"` + arg + `"`
+		}
+		b.WriteString(arg)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,134 @@
+package savefile
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const saved = `create foo hash:ip,port family inet hashsize 1024 maxelem 65536 timeout 300 comment
+add foo 1.1.1.1,tcp:80 timeout 299 comment "web server"
+add foo 2.2.2.2,udp:53 timeout 10 comment ""
+create bar list:set size 8
+add bar foo
+`
+
+func Test_Parser(t *testing.T) {
+	t.Parallel()
+
+	t.Run("save", func(t *testing.T) {
+		cmds, err := ParseAll(strings.NewReader(saved))
+		require.Nil(t, err)
+		require.Len(t, cmds, 5)
+
+		assert.Equal(t, &CreateCommand{
+			Set:  "foo",
+			Type: "hash:ip,port",
+			Options: Options{
+				{"family", "inet"},
+				{"hashsize", "1024"},
+				{"maxelem", "65536"},
+				{"timeout", "300"},
+				{"comment", ""},
+			},
+		}, cmds[0])
+		assert.Equal(t, &AddCommand{
+			Set:     "foo",
+			Entry:   "1.1.1.1,tcp:80",
+			Options: Options{{"timeout", "299"}, {"comment", "web server"}},
+		}, cmds[1])
+		v, ok := cmds[2].(*AddCommand).Options.Get("comment")
+		assert.True(t, ok)
+		assert.Equal(t, "", v)
+		assert.Equal(t, &AddCommand{Set: "bar", Entry: "foo"}, cmds[4])
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		p := NewParser(strings.NewReader("# comment\n\nflush\ndel foo 1.1.1.1\nswap foo bar\nrename foo baz\ndestroy foo\nCOMMIT\n"))
+		want := []Command{
+			&FlushCommand{},
+			&DelCommand{Set: "foo", Entry: "1.1.1.1"},
+			&SwapCommand{From: "foo", To: "bar"},
+			&RenameCommand{From: "foo", To: "baz"},
+			&DestroyCommand{Set: "foo"},
+			&CommitCommand{},
+		}
+		for i, w := range want {
+			cmd, err := p.Next()
+			require.Nil(t, err)
+			assert.Equal(t, w, cmd)
+			assert.Equal(t, i+3, p.Line())
+		}
+		_, err := p.Next()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, line := range []string{
+			"list foo",
+			"create foo",
+			"add foo 1.1.1.1 timeout",
+			"add foo 1.1.1.1 unknown 1",
+			`add foo 1.1.1.1 comment "x`,
+			"swap foo",
+			"COMMIT foo",
+		} {
+			_, err := ParseAll(strings.NewReader("flush\n" + line))
+			var e *SyntaxError
+			require.ErrorAs(t, err, &e, line)
+			assert.Equal(t, 2, e.Line)
+		}
+	})
+}
+
+func Test_Encoder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("round trip", func(t *testing.T) {
+		cmds, err := ParseAll(strings.NewReader(saved))
+		require.Nil(t, err)
+
+		b := &bytes.Buffer{}
+		e := NewEncoder(b)
+		for _, cmd := range cmds {
+			require.Nil(t, e.Encode(cmd))
+		}
+		require.Nil(t, e.Flush())
+		assert.Equal(t, saved, b.String())
+	})
+
+	t.Run("quote", func(t *testing.T) {
+		line, err := Format(&AddCommand{Set: "foo", Entry: "1.1.1.1", Options: Options{{"comment", "x"}}})
+		require.Nil(t, err)
+		assert.Equal(t, `add foo 1.1.1.1 comment "x"`, line)
+
+		line, err = Format(&FlushCommand{})
+		require.Nil(t, err)
+		assert.Equal(t, "flush", line)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := Format(&AddCommand{Set: "foo", Entry: "1.1.1.1", Options: Options{{"comment", `"x"`}}})
+		assert.NotNil(t, err)
+
+		_, err = Format(&CreateCommand{Set: "foo", Type: "hash:ip", Options: Options{{"nomatch", ""}}})
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_Split(t *testing.T) {
+	t.Parallel()
+
+	args, err := Split(`  add foo 1.1.1.1	comment "a b"  timeout 1 `)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"add", "foo", "1.1.1.1", "comment", "a b", "timeout", "1"}, args)
+
+	_, err = Split(`add foo 1.1.1.1 comment "a b`)
+	assert.Error(t, err)
+	_, err = Split("  ")
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package ipset
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -19,6 +20,9 @@ var _ IPSet = (*set)(nil)
 type set struct {
 	name    string
 	setType SetType
+	client  *Client
+	// header validates the entries if it's known
+	header *SetHeader
 }
 
 // Info holds ipset list contents
@@ -30,37 +34,57 @@ type Info struct {
 	SizeInMemory int
 	References   int
 	Entries      []string
+	// Members are the parsed Entries. A member which can't be
+	// parsed only has its Value.
+	Members []Entry
+	// SetHeader is the parsed Header along with the number of
+	// entries.
+	SetHeader SetHeader
 }
 
 func (s set) List(options ...Option) (*Info, error) {
+	return s.ListContext(context.Background(), options...)
+}
+
+func (s set) ListContext(ctx context.Context, options ...Option) (*Info, error) {
 	c := getCmd(_list, s.name, s.setType)
 	defer putCmd(c)
-	if err := c.exec(options...); err != nil {
+	if err := c.exec(ctx, s.client.backend, options...); err != nil {
 		return nil, err
 	}
 
-	info, err := parseInfo(c.out)
+	info, err := parseInfo(s.setType, c.out)
 	if err != nil {
 		return nil, err
 	}
 	info.Name = s.name
-	info.SetType = s.setType
 	return info, err
 }
 
-func parseInfo(out []byte) (info *Info, err error) {
-	info = &Info{}
+func parseInfo(setType SetType, out []byte) (info *Info, err error) {
+	info = &Info{SetType: setType}
 	s := bufio.NewScanner(bytes.NewReader(out))
 
 	for s.Scan() {
 		t := s.Text()
 		switch {
+		case strings.HasPrefix(t, "Na"):
+			info.Name = t[6:]
+		case strings.HasPrefix(t, "T"):
+			info.SetType = SetType(t[6:])
+			setType = info.SetType
 		case strings.HasPrefix(t, "Rev"):
 			if info.Revision, err = getNumber(t); err != nil {
 				return nil, err
 			}
 		case strings.HasPrefix(t, "H"):
 			info.Header = t[8:]
+			var h *SetHeader
+			if h, err = ParseHeader(info.Header); err != nil {
+				return nil, err
+			}
+			h.Entries = info.SetHeader.Entries
+			info.SetHeader = *h
 		case strings.HasPrefix(t, "S"):
 			if info.SizeInMemory, err = getNumber(t); err != nil {
 				return nil, err
@@ -69,18 +93,47 @@ func parseInfo(out []byte) (info *Info, err error) {
 			if info.References, err = getNumber(t); err != nil {
 				return nil, err
 			}
+		case strings.HasPrefix(t, "Num"):
+			if info.SetHeader.Entries, err = getNumber(t); err != nil {
+				return nil, err
+			}
 		case strings.HasPrefix(t, "M"):
 			goto Entries
 		}
 	}
 Entries:
 	for s.Scan() {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		e, perr := ParseEntry(setType, s.Text())
+		if perr != nil {
+			e = &Entry{Value: strings.Fields(s.Text())[0]}
+		}
 		info.Entries = append(info.Entries, s.Text())
+		info.Members = append(info.Members, *e)
 	}
 
 	return
 }
 
+// parseInfos parses the output of listing all sets which are
+// separated by empty lines.
+func parseInfos(out []byte) ([]*Info, error) {
+	var infos []*Info
+	for _, b := range bytes.Split(out, []byte("\n\n")) {
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		info, err := parseInfo("", b)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
 func getNumber(t string) (n int, err error) {
 	if i := strings.LastIndexByte(t, ' '); i != -1 {
 		return strconv.Atoi(t[i+1:])
@@ -89,7 +142,11 @@ func getNumber(t string) (n int, err error) {
 }
 
 func (s set) ListToFile(filename string, options ...Option) error {
-	return s.doToFile(_list, filename, options...)
+	return s.ListToFileContext(context.Background(), filename, options...)
+}
+
+func (s set) ListToFileContext(ctx context.Context, filename string, options ...Option) error {
+	return s.doToFile(ctx, _list, filename, options...)
 }
 
 func (s set) Name() string {
@@ -97,55 +154,118 @@ func (s set) Name() string {
 }
 
 func (s set) Rename(newName string) error {
-	return s.do(_rename, newName)
+	return s.RenameContext(context.Background(), newName)
+}
+
+func (s set) RenameContext(ctx context.Context, newName string) error {
+	return s.do(ctx, _rename, newName)
 }
 
 func (s set) Add(entry string, options ...Option) error {
-	return s.do(_add, entry, options...)
+	return s.AddContext(context.Background(), entry, options...)
+}
+
+func (s set) AddContext(ctx context.Context, entry string, options ...Option) error {
+	return s.do(ctx, _add, entry, options...)
 }
 
 func (s set) Del(entry string, options ...Option) error {
-	return s.do(_del, entry, options...)
+	return s.DelContext(context.Background(), entry, options...)
 }
 
-var notFlag = []byte("NOT")
+func (s set) DelContext(ctx context.Context, entry string, options ...Option) error {
+	return s.do(ctx, _del, entry, options...)
+}
+
+func (s set) Test(entry string, options ...Option) (bool, error) {
+	return s.TestContext(context.Background(), entry, options...)
+}
 
-func (s set) Test(entry string) (bool, error) {
-	out, err := execCommand(ipsetPath, _test, s.name, entry).
-		CombinedOutput()
+func (s set) TestContext(ctx context.Context, entry string, options ...Option) (bool, error) {
+	if err := s.validate(_test, entry); err != nil {
+		return false, err
+	}
+	c := getCmd(_test, s.name, s.setType, entry)
+	defer putCmd(c)
+	if err := c.check(options...); err != nil {
+		return false, err
+	}
+	out, err := run(ctx, s.client.backend, c.op(), nil, c.buildArgs(options...)...)
 
 	if err != nil {
-		if bytes.Contains(out, notFlag) {
+		if ctx.Err() == nil && notInSet(out) {
 			return false, nil
 		}
-		return false, fmt.Errorf("ipset: can't test %s %s: %s", s.name, entry, out)
+		return false, err
 	}
 
 	return true, nil
 }
 
+// notInSet checks whether the output of test reports the entry
+// is not in the set, i.e.
+//      1.1.1.1 is NOT in set foo.
+func notInSet(out []byte) bool {
+	return bytes.Contains(out, notInSetFlag)
+}
+
+var notInSetFlag = []byte(" is NOT in set ")
+
 func (s set) Flush() error {
-	return flush(s.name)
+	return s.FlushContext(context.Background())
+}
+
+func (s set) FlushContext(ctx context.Context) error {
+	return s.client.flush(ctx, s.name)
 }
 
 func (s set) Destroy() error {
-	return destroy(s.name)
+	return s.DestroyContext(context.Background())
+}
+
+func (s set) DestroyContext(ctx context.Context) error {
+	return s.client.destroy(ctx, s.name)
 }
 
-func (s set) do(action, entry string, options ...Option) error {
+func (s set) do(ctx context.Context, action, entry string, options ...Option) error {
+	if err := s.validate(action, entry); err != nil {
+		return err
+	}
 	c := getCmd(action, s.name, s.setType, entry)
 	defer putCmd(c)
 
-	if err := c.exec(options...); err != nil {
+	if err := c.exec(ctx, s.client.backend, options...); err != nil {
 		return err
 	}
 	return nil
 }
 
+// validate checks the entry of add, del and test before it's
+// given to ipset, see SetType.ValidateEntry.
+func (s set) validate(action, entry string) error {
+	if s.setType == "" || action != _add && action != _del && action != _test {
+		return nil
+	}
+	if err := s.setType.ValidateEntry(entry, s.header); err != nil {
+		return &OpError{
+			Action: action,
+			Set:    s.name,
+			Entry:  entry,
+			Err:    err,
+			op:     action + " " + s.name + " " + entry,
+		}
+	}
+	return nil
+}
+
 func (s set) Save(options ...Option) (io.Reader, error) {
+	return s.SaveContext(context.Background(), options...)
+}
+
+func (s set) SaveContext(ctx context.Context, options ...Option) (io.Reader, error) {
 	c := getCmd(_save, s.name, s.setType)
 	defer putCmd(c)
-	if err := c.exec(options...); err != nil {
+	if err := c.exec(ctx, s.client.backend, options...); err != nil {
 		return nil, err
 	}
 
@@ -153,13 +273,17 @@ func (s set) Save(options ...Option) (io.Reader, error) {
 }
 
 func (s set) SaveToFile(filename string, options ...Option) error {
-	return s.doToFile(_save, filename, options...)
+	return s.SaveToFileContext(context.Background(), filename, options...)
+}
+
+func (s set) SaveToFileContext(ctx context.Context, filename string, options ...Option) error {
+	return s.doToFile(ctx, _save, filename, options...)
 }
 
-func (s set) doToFile(action, filename string, options ...Option) error {
+func (s set) doToFile(ctx context.Context, action, filename string, options ...Option) error {
 	c := getCmd(action, s.name, s.setType)
 	defer putCmd(c)
-	if err := c.exec(options...); err != nil {
+	if err := c.exec(ctx, s.client.backend, options...); err != nil {
 		return err
 	}
 
@@ -168,10 +292,14 @@ func (s set) doToFile(action, filename string, options ...Option) error {
 
 var maxRestoreSize = 1 << 16
 
-func (s set) Restore(r io.Reader, exist ...bool) (err error) {
+func (s set) Restore(r io.Reader, exist ...bool) error {
+	return s.RestoreContext(context.Background(), r, exist...)
+}
+
+func (s set) RestoreContext(ctx context.Context, r io.Reader, exist ...bool) (err error) {
 	defer func() {
-		if err != nil {
-			err = fmt.Errorf("ipset: can't restore to %s(%s): %s", s.name, s.setType, err)
+		if _, ok := err.(*OpError); err != nil && !ok {
+			err = fmt.Errorf("ipset: can't %s: %w", s.restoreOp(), err)
 		}
 	}()
 
@@ -191,7 +319,7 @@ func (s set) Restore(r io.Reader, exist ...bool) (err error) {
 			return
 		}
 		if b.Len()+len(bb) > maxRestoreSize {
-			if err = s.restore(b.Bytes(), exist...); err != nil {
+			if err = s.restore(ctx, b.Bytes(), exist...); err != nil {
 				return
 			}
 			b.Reset()
@@ -200,42 +328,35 @@ func (s set) Restore(r io.Reader, exist ...bool) (err error) {
 			return
 		}
 	}
-	return s.restore(b.Bytes(), exist...)
+	return s.restore(ctx, b.Bytes(), exist...)
 }
 
 // restore data to ipset and length of b should
-// be less than 64K because of the size limit of
-// pipe.
-func (s set) restore(b []byte, exist ...bool) (err error) {
+// be less than maxRestoreSize, so a huge input is
+// restored by several sessions.
+func (s set) restore(ctx context.Context, b []byte, exist ...bool) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	args := []string{_restore}
 	if len(exist) > 0 && exist[0] {
 		args = append(args, _exist)
 	}
-	c := execCommand(ipsetPath, args...)
-
-	var pipe io.WriteCloser
-	pipe, err = c.StdinPipe()
-	if err != nil {
-		return err
-	}
-
-	if _, err = pipe.Write(b); err != nil {
-		return pipe.Close()
-	}
 
-	if err = pipe.Close(); err != nil {
-		return
-	}
+	_, err = run(ctx, s.client.backend, s.restoreOp(), b, args...)
+	return
+}
 
-	var out []byte
-	if out, err = c.CombinedOutput(); err != nil {
-		return fmt.Errorf("%s", out)
-	}
+func (s set) restoreOp() string {
+	return fmt.Sprintf("%s to %s(%s)", _restore, s.name, s.setType)
+}
 
-	return
+func (s set) RestoreFromFile(filename string, exist ...bool) error {
+	return s.RestoreFromFileContext(context.Background(), filename, exist...)
 }
 
-func (s set) RestoreFromFile(filename string, exist ...bool) (err error) {
+func (s set) RestoreFromFileContext(ctx context.Context, filename string, exist ...bool) (err error) {
 	var f *os.File
 	f, err = os.Open(filepath.Clean(filename))
 	if err != nil {
@@ -246,7 +367,7 @@ func (s set) RestoreFromFile(filename string, exist ...bool) (err error) {
 			err = e
 		}
 	}()
-	return s.Restore(f, exist...)
+	return s.RestoreContext(ctx, f, exist...)
 }
 
 var readerPool sync.Pool
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"testing"
 
@@ -24,8 +25,18 @@ func Test_Set_List(t *testing.T) {
 		assert.Equal(t, s.setType, info.SetType)
 		assert.Equal(t, 4, info.Revision)
 		assert.Equal(t, "family inet hashsize 1024 maxelem 65536", info.Header)
+		assert.Equal(t, SetHeader{Family: Inet, HashSize: 1024, MaxElem: 65536, Entries: 1}, info.SetHeader)
 		assert.Equal(t, 0, info.References)
 		assert.Equal(t, "1.1.1.1", info.Entries[0])
+		assert.Equal(t, []Entry{{Value: "1.1.1.1", IP: net.ParseIP("1.1.1.1")}}, info.Members)
+	})
+
+	t.Run("unparsable member", func(t *testing.T) {
+		info, err := parseInfo(HashIp, []byte(listInfo+"\n  \t\n1.1.1.2,80 timeout 10\n"))
+		require.Nil(t, err)
+		assert.Equal(t, []string{"1.1.1.1", "1.1.1.2,80 timeout 10"}, info.Entries)
+		require.Len(t, info.Members, 2)
+		assert.Equal(t, Entry{Value: "1.1.1.2,80"}, info.Members[1])
 	})
 
 	t.Run("error", func(t *testing.T) {
@@ -92,6 +103,15 @@ func Test_Set_Rename(t *testing.T) {
 		require.Nil(t, err)
 	})
 
+	t.Run("multi-dimension", func(t *testing.T) {
+		setupCmd()
+		defer teardownCmd()
+
+		require.Nil(t, getSet(HashIpPort).Rename("bar"))
+		require.Nil(t, getSet(HashNetIface).Rename("block-v1.2"))
+		require.Nil(t, getSet(HashIp).Rename("block-v1.2"))
+	})
+
 	t.Run("error", func(t *testing.T) {
 		setupCmd(flag)
 		defer teardownCmd()
@@ -377,7 +397,7 @@ func Test_Set_RestoreFromFile(t *testing.T) {
 }
 
 func getSet(setType ...SetType) set {
-	s := set{"test", HashIp}
+	s := set{"test", HashIp, std, nil}
 	if len(setType) > 0 {
 		s.setType = setType[0]
 	}
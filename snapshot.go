@@ -0,0 +1,235 @@
+package ipset
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gonetx/ipset/savefile"
+)
+
+// SaveAll writes all sets in the format of ipset save to w.
+func (c *Client) SaveAll(w io.Writer) error {
+	return c.SaveAllContext(context.Background(), w)
+}
+
+// SaveAllContext is like SaveAll but aborts as soon as ctx is done.
+func (c *Client) SaveAllContext(ctx context.Context, w io.Writer) error {
+	out, err := run(ctx, c.backend, "save all set", nil, _save)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// Snapshot is the state of all sets, i.e. their types, headers
+// and entries, taken by TakeSnapshot and restored by Rollback.
+type Snapshot struct {
+	sets []*snapshotSet
+}
+
+type snapshotSet struct {
+	create *savefile.CreateCommand
+	adds   []*savefile.AddCommand
+}
+
+// LoadSnapshot reads a snapshot written by Snapshot.WriteTo or
+// ipset save.
+func LoadSnapshot(r io.Reader) (*Snapshot, error) {
+	cmds, err := savefile.ParseAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ipset: can't load snapshot: %w", err)
+	}
+
+	snap := &Snapshot{}
+	sets := make(map[string]*snapshotSet)
+	for _, cmd := range cmds {
+		switch c := cmd.(type) {
+		case *savefile.CreateCommand:
+			if sets[c.Set] != nil {
+				return nil, fmt.Errorf("ipset: can't load snapshot: duplicate set %s", c.Set)
+			}
+			sets[c.Set] = &snapshotSet{create: c}
+			snap.sets = append(snap.sets, sets[c.Set])
+		case *savefile.AddCommand:
+			if sets[c.Set] == nil {
+				return nil, fmt.Errorf("ipset: can't load snapshot: set %s is not created", c.Set)
+			}
+			sets[c.Set].adds = append(sets[c.Set].adds, c)
+		case *savefile.CommitCommand:
+		default:
+			return nil, fmt.Errorf("ipset: can't load snapshot: unexpected %s", cmd.Action())
+		}
+	}
+	return snap, nil
+}
+
+// Names returns the names of the sets in the snapshot.
+func (snap *Snapshot) Names() []string {
+	names := make([]string, len(snap.sets))
+	for i, s := range snap.sets {
+		names[i] = s.create.Set
+	}
+	return names
+}
+
+// WriteTo writes the snapshot in the format of ipset save to w.
+func (snap *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	b := &bytes.Buffer{}
+	e := savefile.NewEncoder(b)
+	for _, s := range snap.sets {
+		if err := e.Encode(s.create); err != nil {
+			return 0, err
+		}
+		for _, add := range s.adds {
+			if err := e.Encode(add); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return 0, err
+	}
+	return b.WriteTo(w)
+}
+
+// TakeSnapshot saves the state of all sets.
+func (c *Client) TakeSnapshot() (*Snapshot, error) {
+	return c.TakeSnapshotContext(context.Background())
+}
+
+// TakeSnapshotContext is like TakeSnapshot but aborts as soon as
+// ctx is done.
+func (c *Client) TakeSnapshotContext(ctx context.Context) (*Snapshot, error) {
+	b := &bytes.Buffer{}
+	if err := c.SaveAllContext(ctx, b); err != nil {
+		return nil, err
+	}
+	return LoadSnapshot(b)
+}
+
+// snapshot saves the state of the sets of names, skipping the
+// ones which don't exist.
+func (c *Client) snapshot(ctx context.Context, names []string) (*Snapshot, error) {
+	b := &bytes.Buffer{}
+	for _, name := range names {
+		out, err := run(ctx, c.backend, "save "+name, nil, _save, name)
+		if errors.Is(err, ErrSetNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		b.Write(out)
+	}
+	return LoadSnapshot(b)
+}
+
+// Rollback restores the exact state of snap: the sets in it are
+// rebuilt as temporary sets and swapped in, so the references of
+// kernel components such as iptables rules are kept, unless the
+// current set has another type or family and is replaced. The
+// sets created since the snapshot are destroyed.
+func (c *Client) Rollback(snap *Snapshot) error {
+	return c.RollbackContext(context.Background(), snap)
+}
+
+// RollbackContext is like Rollback but aborts as soon as ctx is
+// done.
+func (c *Client) RollbackContext(ctx context.Context, snap *Snapshot) error {
+	return c.rollback(ctx, snap, func(string) bool { return true })
+}
+
+// rollback restores the state of snap for the sets whose names
+// are selected.
+func (c *Client) rollback(ctx context.Context, snap *Snapshot, selected func(name string) bool) error {
+	infos, err := c.listAll(ctx, nil, _terse)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]*Info, len(infos))
+	for _, info := range infos {
+		current[info.Name] = info
+	}
+
+	var (
+		cmds    []savefile.Command
+		managed = make(map[string]bool)
+	)
+	// list:set is restored after its members and destroyed before them
+	for _, list := range []bool{false, true} {
+		for _, s := range snap.sets {
+			if selected(s.create.Set) && (SetType(s.create.Type) == ListSet) == list {
+				cmds = append(cmds, rollbackSet(s, current)...)
+				managed[s.create.Set] = true
+			}
+		}
+	}
+	for _, list := range []bool{true, false} {
+		for _, info := range infos {
+			if selected(info.Name) && !managed[info.Name] && (info.SetType == ListSet) == list {
+				cmds = append(cmds, &savefile.DestroyCommand{Set: info.Name})
+			}
+		}
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	b := &bytes.Buffer{}
+	e := savefile.NewEncoder(b)
+	for _, cmd := range cmds {
+		if err = e.Encode(cmd); err != nil {
+			return fmt.Errorf("ipset: can't rollback: %w", err)
+		}
+	}
+	if err = e.Flush(); err != nil {
+		return err
+	}
+	return c.RestoreAllContext(ctx, b)
+}
+
+// rollbackSet returns the commands which rebuild s as a temporary
+// set and put it in place of the current one.
+func rollbackSet(s *snapshotSet, current map[string]*Info) []savefile.Command {
+	name := s.create.Set
+	tmp := tmpName(name)
+
+	cmds := []savefile.Command{&savefile.CreateCommand{Set: tmp, Type: s.create.Type, Options: s.create.Options}}
+	for _, add := range s.adds {
+		cmds = append(cmds, &savefile.AddCommand{Set: tmp, Entry: add.Entry, Options: add.Options})
+	}
+
+	cur := current[name]
+	switch {
+	case cur != nil && swappable(s.create, cur):
+		return append(cmds, &savefile.SwapCommand{From: tmp, To: name}, &savefile.DestroyCommand{Set: tmp})
+	case cur != nil:
+		cmds = append(cmds, &savefile.DestroyCommand{Set: name})
+	}
+	return append(cmds, &savefile.RenameCommand{From: tmp, To: name})
+}
+
+// swappable reports whether the set created by create can be
+// swapped with the current one, which requires the same type
+// and family.
+func swappable(create *savefile.CreateCommand, cur *Info) bool {
+	if SetType(create.Type) != cur.SetType {
+		return false
+	}
+	family, _ := create.Options.Get(_family)
+	return defaultFamily(create.Type, family) == defaultFamily(create.Type, string(cur.SetHeader.Family))
+}
+
+// defaultFamily fills the family which ipset defaults to inet for
+// hash types.
+func defaultFamily(setType, family string) string {
+	if family == "" && strings.HasPrefix(setType, "hash:") {
+		return string(Inet)
+	}
+	return family
+}
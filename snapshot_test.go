@@ -0,0 +1,79 @@
+package ipset
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Client_SaveAll(t *testing.T) {
+	t.Parallel()
+
+	b := &fakeBackend{out: "create foo hash:ip\n"}
+	w := &bytes.Buffer{}
+	require.Nil(t, NewClient(b).SaveAll(w))
+	assert.Equal(t, [][]string{{_save}}, b.args)
+	assert.Equal(t, "create foo hash:ip\n", w.String())
+
+	b.err = errors.New("exit")
+	assert.Equal(t, "ipset: can't save all set: create foo hash:ip\n", NewClient(b).SaveAll(w).Error())
+}
+
+func Test_LoadSnapshot(t *testing.T) {
+	t.Parallel()
+
+	saved := "create foo hash:ip family inet hashsize 1024 maxelem 65536 comment\n" +
+		"add foo 1.1.1.1 comment \"a b\"\n" +
+		"create bar list:set size 8\n" +
+		"add bar foo\n"
+	snap, err := LoadSnapshot(strings.NewReader(saved + "COMMIT\n"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"foo", "bar"}, snap.Names())
+
+	w := &bytes.Buffer{}
+	n, err := snap.WriteTo(w)
+	require.Nil(t, err)
+	assert.Equal(t, int64(len(saved)), n)
+	assert.Equal(t, saved, w.String())
+
+	for _, s := range []string{
+		"add foo 1.1.1.1\n",
+		"create foo hash:ip\ncreate foo hash:ip\n",
+		"flush foo\n",
+	} {
+		_, err = LoadSnapshot(strings.NewReader(s))
+		assert.NotNil(t, err, s)
+	}
+}
+
+func Test_Client_Rollback(t *testing.T) {
+	t.Parallel()
+
+	k := newFakeKernel()
+	c := NewClient(k.backend())
+	require.Nil(t, c.RestoreAll(strings.NewReader(
+		"create foo hash:ip comment\nadd foo 1.1.1.1 comment \"a b\"\n"+
+			"create bar hash:net\nadd bar 10.0.0.0/8\n"+
+			"create baz hash:ip\nadd baz 3.3.3.3\n"+
+			"create list list:set\nadd list foo\n")))
+
+	saved := &bytes.Buffer{}
+	require.Nil(t, c.SaveAll(saved))
+	require.Contains(t, saved.String(), "add list foo")
+	snap, err := c.TakeSnapshot()
+	require.Nil(t, err)
+
+	// add, remove and recreate with another type
+	require.Nil(t, c.RestoreAll(strings.NewReader(
+		"add foo 2.2.2.2\ndel list foo\nadd list baz\ndestroy bar\n"+
+			"destroy list\ndestroy baz\ncreate baz hash:net\ncreate new hash:ip\n")))
+
+	require.Nil(t, c.Rollback(snap))
+	now := &bytes.Buffer{}
+	require.Nil(t, c.SaveAll(now))
+	assert.Equal(t, saved.String(), now.String())
+}
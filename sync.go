@@ -0,0 +1,88 @@
+package ipset
+
+import "context"
+
+// SyncReport reports the changes made by Sync.
+type SyncReport struct {
+	// Added are the desired entries which were not in the set.
+	Added []Entry
+	// Removed are the entries which were in the set but not
+	// desired.
+	Removed []Entry
+	// Updated are the desired entries whose extensions, i.e.
+	// timeout or comment, were changed.
+	Updated []Entry
+}
+
+func (s set) Sync(desired []Entry) (*SyncReport, error) {
+	return s.SyncContext(context.Background(), desired)
+}
+
+func (s set) SyncContext(ctx context.Context, desired []Entry) (*SyncReport, error) {
+	info, err := s.ListContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]*Entry, len(info.Members))
+	for i := range info.Members {
+		current[info.Members[i].key(s.setType)] = &info.Members[i]
+	}
+
+	var (
+		report = &SyncReport{}
+		lines  []batchLine
+		seen   = make(map[string]bool, len(desired))
+	)
+	for i := range desired {
+		e := &desired[i]
+		key := e.key(s.setType)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		cur, ok := current[key]
+		switch {
+		case !ok:
+			report.Added = append(report.Added, *e)
+		case changed(cur, e):
+			report.Updated = append(report.Updated, *e)
+		default:
+			continue
+		}
+		c := getCmd(_add, s.name, s.setType, e.Value)
+		lines = append(lines, batchLine{_add, e.Value, c.buildArgs(append(e.options(), Exist(true))...)})
+		putCmd(c)
+	}
+	for i := range info.Members {
+		e := &info.Members[i]
+		if seen[e.key(s.setType)] {
+			continue
+		}
+		report.Removed = append(report.Removed, *e)
+		c := getCmd(_del, s.name, s.setType, e.Value)
+		lines = append(lines, batchLine{_del, e.Value, c.buildArgs(Exist(true))})
+		putCmd(c)
+	}
+
+	if len(lines) == 0 {
+		return report, nil
+	}
+	return report, s.restoreLines(ctx, lines)
+}
+
+// changed reports whether the extensions of the current entry
+// differ from the desired one. Since the timeout of an entry
+// counts down, it's changed only if the desired one is shorter
+// than the remaining one or the current entry is permanent.
+func changed(current, desired *Entry) bool {
+	if desired.Timeout != 0 && (current.Timeout == 0 || current.Timeout > desired.Timeout) {
+		return true
+	}
+	return current.Comment != desired.Comment ||
+		current.Skbmark != desired.Skbmark ||
+		current.Skbprio != desired.Skbprio ||
+		current.Skbqueue != desired.Skbqueue ||
+		current.Nomatch != desired.Nomatch
+}
@@ -0,0 +1,82 @@
+package ipset
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Set_Sync(t *testing.T) {
+	k := newFakeKernel()
+	c := NewClient(k.backend())
+	s, err := c.New("foo", HashIpPort, Comment(true), Timeout(time.Hour))
+	require.Nil(t, err)
+	require.Nil(t, s.Add("1.1.1.1,tcp:80", CommentContent("a")))
+	require.Nil(t, s.Add("2.2.2.2,tcp:53", CommentContent("b")))
+	require.Nil(t, s.Add("3.3.3.3,udp:53"))
+
+	desired := []Entry{
+		{Value: "1.1.1.1,80", Comment: "a"},
+		{Value: "2.2.2.2,tcp:53", Comment: "c"},
+		{Value: "4.4.4.4,udp:1"},
+		{Value: "4.4.4.4,udp:1"},
+	}
+	report, err := s.Sync(desired)
+	require.Nil(t, err)
+	assert.Equal(t, []Entry{desired[2]}, report.Added)
+	assert.Equal(t, []Entry{desired[1]}, report.Updated)
+	require.Len(t, report.Removed, 1)
+	assert.Equal(t, "3.3.3.3,udp:53", report.Removed[0].Value)
+
+	info, err := s.List()
+	require.Nil(t, err)
+	assert.Equal(t, []string{
+		`1.1.1.1,tcp:80 comment "a"`,
+		`2.2.2.2,tcp:53 comment "c"`,
+		`4.4.4.4,udp:1`,
+	}, info.Entries)
+
+	report, err = s.Sync(desired)
+	require.Nil(t, err)
+	assert.Equal(t, &SyncReport{}, report)
+
+	report, err = s.Sync([]Entry{{Value: "4.4.4.4,udp:1", Timeout: time.Minute}})
+	require.Nil(t, err)
+	assert.Len(t, report.Updated, 1)
+	assert.Len(t, report.Removed, 2)
+}
+
+func Test_Changed(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, changed(&Entry{Timeout: time.Minute}, &Entry{}))
+	assert.False(t, changed(&Entry{Timeout: time.Minute}, &Entry{Timeout: time.Hour}))
+	assert.True(t, changed(&Entry{Timeout: time.Hour}, &Entry{Timeout: time.Minute}))
+	assert.True(t, changed(&Entry{}, &Entry{Timeout: time.Minute}))
+	assert.True(t, changed(&Entry{}, &Entry{Nomatch: true}))
+	assert.True(t, changed(&Entry{Comment: "a"}, &Entry{}))
+}
+
+func Test_Set_Sync_Comment(t *testing.T) {
+	k := newFakeKernel()
+	c := NewClient(k.backend())
+	s, err := c.New("foo", HashIp, Comment(true))
+	require.Nil(t, err)
+
+	desired := []Entry{{Value: "1.1.1.1", Comment: `SMB \\fileserv\`}}
+	report, err := s.Sync(desired)
+	require.Nil(t, err)
+	assert.Len(t, report.Added, 1)
+
+	info, err := s.List()
+	require.Nil(t, err)
+	assert.Equal(t, []string{`1.1.1.1 comment "SMB \\fileserv\"`}, info.Entries)
+	require.Len(t, info.Members, 1)
+	assert.Equal(t, `SMB \\fileserv\`, info.Members[0].Comment)
+
+	report, err = s.Sync(desired)
+	require.Nil(t, err)
+	assert.Equal(t, &SyncReport{}, report)
+}
@@ -1,9 +1,11 @@
 package ipset
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"sync"
 	"testing"
 )
 
@@ -12,10 +14,10 @@ var (
 	flag      = struct{}{}
 )
 
-func fakeExecCommand(command string, args ...string) *exec.Cmd {
+func fakeExecCommand(ctx context.Context, command string, args ...string) *exec.Cmd {
 	cs := []string{"-test.run=TestHelperProcess", "--", command}
 	cs = append(cs, args...)
-	cmd := exec.Command(os.Args[0], cs...)
+	cmd := exec.CommandContext(ctx, os.Args[0], cs...)
 	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
 	if needError {
 		cmd.Env = append(cmd.Env, "GO_WANT_HELPER_NEED_ERR=1")
@@ -87,14 +89,14 @@ func findOption(args []string, target string) bool {
 }
 
 func setupCmd(flag ...struct{}) {
-	execCommand = fakeExecCommand
+	execCommandContext = fakeExecCommand
 	if len(flag) > 0 {
 		needError = true
 	}
 }
 
 func teardownCmd() {
-	execCommand = exec.Command
+	execCommandContext = exec.CommandContext
 	needError = false
 }
 
@@ -118,7 +120,7 @@ func setupLookPath(filename ...string) {
 
 func teardownLookPath() {
 	execLookPath = exec.LookPath
-	ipsetPath = ""
+	std = NewClient(NewExecBackend())
 }
 
 const (
@@ -154,3 +156,309 @@ add foo one.one.one.one
 `
 	testNotExistIp = "1.1.1.2"
 )
+
+// fakeKernel is an in-memory ipset of kernel speaking netlink,
+// so that the netlink backend can be tested without root.
+type fakeKernel struct {
+	protocol uint8
+	sets     []*fakeSet
+	replies  [][]byte
+	// missing are the set types whose modules are missing
+	missing map[string]bool
+}
+
+type fakeSet struct {
+	name    string
+	typ     string
+	family  uint8
+	data    []byte
+	entries [][]byte
+}
+
+func newFakeKernel() *fakeKernel {
+	return &fakeKernel{protocol: ipsetProtocol}
+}
+
+// backend returns a netlink backend connected to the kernel.
+func (k *fakeKernel) backend() *netlinkBackend {
+	return &netlinkBackend{dial: func() (nlConn, error) { return k, nil }}
+}
+
+func (k *fakeKernel) send(b []byte) error {
+	cmd := uint8(nativeEndian.Uint16(b[4:]))
+	seq := nativeEndian.Uint32(b[8:])
+	family := b[nlmsgHdrLen]
+	attrs, err := parseNlAttrs(b[nlmsgHdrLen+nfgenmsgLen : nativeEndian.Uint32(b)])
+	if err != nil {
+		return err
+	}
+	if errno := k.handle(cmd, seq, family, attrs); errno != 0 || cmd < ipsetCmdList || cmd > ipsetCmdSave {
+		k.reply(seq, nlmsgError, nil, errno)
+	} else {
+		k.reply(seq, nlmsgDone, nil, 0)
+	}
+	return nil
+}
+
+func (k *fakeKernel) receive(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(k.replies) == 0 {
+		return nil, fmt.Errorf("no reply")
+	}
+	b := k.replies[0]
+	k.replies = k.replies[1:]
+	return b, nil
+}
+
+func (k *fakeKernel) close() error {
+	return nil
+}
+
+func (k *fakeKernel) reply(seq uint32, typ uint16, r *nlRequest, errno int) {
+	if r == nil {
+		r = newNlRequest(0, 0)
+		r.b = r.b[:nlmsgHdrLen]
+		r.b = append(r.b, 0, 0, 0, 0)
+		nativeEndian.PutUint32(r.b[nlmsgHdrLen:], uint32(-int32(errno)))
+	}
+	b := r.message(seq)
+	nativeEndian.PutUint16(b[4:], typ)
+	k.replies = append(k.replies, append([]byte(nil), b...))
+}
+
+// sockConn wraps a fakeKernel the way a real socket behaves:
+// every datagram is received into the same buffer and the
+// acknowledgment echoes the request.
+type sockConn struct {
+	k   *fakeKernel
+	buf []byte
+}
+
+// sockBackend returns a netlink backend connected to the kernel
+// through a sockConn.
+func (k *fakeKernel) sockBackend() *netlinkBackend {
+	return &netlinkBackend{dial: func() (nlConn, error) {
+		return &sockConn{k: k, buf: make([]byte, nlBufferSize)}, nil
+	}}
+}
+
+func (c *sockConn) send(b []byte) error {
+	if err := c.k.send(b); err != nil {
+		return err
+	}
+	last := c.k.replies[len(c.k.replies)-1]
+	if nativeEndian.Uint16(last[4:]) == nlmsgError {
+		ack := append(last[:nlmsgHdrLen+4:nlmsgHdrLen+4], b...)
+		nativeEndian.PutUint32(ack, uint32(len(ack)))
+		c.k.replies[len(c.k.replies)-1] = ack
+	}
+	return nil
+}
+
+func (c *sockConn) receive(ctx context.Context) ([]byte, error) {
+	b, err := c.k.receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.buf[:copy(c.buf, b)], nil
+}
+
+func (c *sockConn) close() error {
+	return nil
+}
+
+func (k *fakeKernel) find(name string) *fakeSet {
+	for _, s := range k.sets {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (k *fakeKernel) handle(cmd uint8, seq uint32, family uint8, attrs nlAttrs) int {
+	if attrs.u8(ipsetAttrProtocol) < ipsetProtocolMin {
+		return ipsetErrProtocol
+	}
+	name := attrs.str(ipsetAttrSetName)
+	set := k.find(name)
+	exist := attrs.u32(ipsetAttrFlags)&ipsetFlagExist != 0
+
+	switch cmd {
+	case ipsetCmdProtocol:
+		r := newNlRequest(cmd, 0)
+		r.u8(ipsetAttrProtocol, k.protocol)
+		r.u8(ipsetAttrProtocolMin, ipsetProtocolMin)
+		k.reply(seq, nfnlSubsysIPSet<<8|uint16(cmd), r, 0)
+	case ipsetCmdType:
+		if typ := attrs.str(ipsetAttrTypeName); typ == "hash:unknown" || k.missing[typ] {
+			return ipsetErrFindType
+		}
+		r := newNlRequest(cmd, family)
+		r.u8(ipsetAttrRevision, 4)
+		r.u8(ipsetAttrRevisionMin, 0)
+		k.reply(seq, nfnlSubsysIPSet<<8|uint16(cmd), r, 0)
+	case ipsetCmdHeader:
+		if set == nil {
+			return errnoENOENT
+		}
+		r := newNlRequest(cmd, set.family)
+		r.str(ipsetAttrSetName, set.name)
+		r.str(ipsetAttrTypeName, set.typ)
+		r.u8(ipsetAttrRevision, 4)
+		r.u8(ipsetAttrFamily, set.family)
+		k.reply(seq, nfnlSubsysIPSet<<8|uint16(cmd), r, 0)
+	case ipsetCmdCreate:
+		if set != nil {
+			if exist && set.typ == attrs.str(ipsetAttrTypeName) {
+				return 0
+			}
+			return errnoEEXIST
+		}
+		k.sets = append(k.sets, &fakeSet{
+			name:   name,
+			typ:    attrs.str(ipsetAttrTypeName),
+			family: attrs.u8(ipsetAttrFamily),
+			data:   append([]byte(nil), attrs.get(ipsetAttrData)...),
+		})
+	case ipsetCmdAdd, ipsetCmdDel, ipsetCmdTest:
+		if set == nil {
+			return errnoENOENT
+		}
+		data := attrs.get(ipsetAttrData)
+		i := set.index(data)
+		// nomatch entries are matched by the tests with nomatch only
+		nomatch := func(b []byte) bool {
+			attrs, _ := parseNlAttrs(b)
+			return attrs.u32(ipsetAttrCadtFlags)&ipsetFlagNomatch != 0
+		}
+		switch {
+		case cmd == ipsetCmdTest && (i == -1 || nomatch(set.entries[i]) && !nomatch(data)),
+			cmd == ipsetCmdAdd && i != -1 && !exist,
+			cmd == ipsetCmdDel && i == -1 && !exist:
+			return ipsetErrExist
+		case cmd == ipsetCmdAdd && i != -1:
+			set.entries[i] = append([]byte(nil), data...)
+		case cmd == ipsetCmdAdd:
+			set.entries = append(set.entries, append([]byte(nil), data...))
+		case cmd == ipsetCmdDel && i != -1:
+			set.entries = append(set.entries[:i], set.entries[i+1:]...)
+		}
+	case ipsetCmdDestroy, ipsetCmdFlush:
+		if name != "" && set == nil {
+			return errnoENOENT
+		}
+		for i := 0; i < len(k.sets); i++ {
+			if name == "" || k.sets[i] == set {
+				if cmd == ipsetCmdFlush {
+					k.sets[i].entries = nil
+					continue
+				}
+				k.sets = append(k.sets[:i], k.sets[i+1:]...)
+				i--
+			}
+		}
+	case ipsetCmdRename, ipsetCmdSwap:
+		if set == nil {
+			return errnoENOENT
+		}
+		other := k.find(attrs.str(ipsetAttrSetName2))
+		switch {
+		case cmd == ipsetCmdRename && other != nil:
+			return ipsetErrExistSetName2
+		case cmd == ipsetCmdRename:
+			set.name = attrs.str(ipsetAttrSetName2)
+		case other == nil:
+			return ipsetErrExistSetName2
+		case other.typ != set.typ:
+			return ipsetErrTypeMismatch
+		default:
+			set.name, other.name = other.name, set.name
+		}
+	case ipsetCmdList, ipsetCmdSave:
+		if name != "" && set == nil {
+			return errnoENOENT
+		}
+		for _, s := range k.sets {
+			if name != "" && s != set {
+				continue
+			}
+			r := newNlRequest(cmd, s.family)
+			r.str(ipsetAttrSetName, s.name)
+			if attrs.u32(ipsetAttrFlags)&ipsetFlagListSetName != 0 {
+				k.reply(seq, nfnlSubsysIPSet<<8|uint16(cmd), r, 0)
+				continue
+			}
+			r.str(ipsetAttrTypeName, s.typ)
+			r.u8(ipsetAttrRevision, 4)
+			r.u8(ipsetAttrFamily, s.family)
+			r.begin(ipsetAttrData)
+			r.b = append(r.b, s.data...)
+			r.u32(ipsetAttrElements, uint32(len(s.entries)))
+			r.u32(ipsetAttrReferences, 0)
+			r.u32(ipsetAttrMemSize, 168)
+			r.end()
+			if attrs.u32(ipsetAttrFlags)&ipsetFlagListHeader == 0 {
+				r.begin(ipsetAttrADT)
+				for _, e := range s.entries {
+					r.attr(ipsetAttrData|nlaFNested, e)
+				}
+				r.end()
+			}
+			k.reply(seq, nfnlSubsysIPSet<<8|uint16(cmd), r, 0)
+		}
+	}
+	return 0
+}
+
+// index finds the entry by comparing the attributes which are
+// not extensions.
+func (s *fakeSet) index(data []byte) int {
+	key := func(b []byte) string {
+		attrs, _ := parseNlAttrs(b)
+		var k string
+		for _, a := range attrs {
+			switch a.typ {
+			case ipsetAttrTimeout, ipsetAttrCadtFlags, ipsetAttrPackets,
+				ipsetAttrBytes, ipsetAttrComment, ipsetAttrSkbMark,
+				ipsetAttrSkbPrio, ipsetAttrSkbQueue, ipsetAttrLineNo:
+				continue
+			}
+			k += fmt.Sprintf("%d:%x;", a.typ, a.data)
+		}
+		return k
+	}
+	for i, e := range s.entries {
+		if key(e) == key(data) {
+			return i
+		}
+	}
+	return -1
+}
+
+// fakeBackend records the commands run by a client and returns
+// the output and error set by tests.
+type fakeBackend struct {
+	mu    sync.Mutex
+	args  [][]string
+	stdin [][]byte
+	out   string
+	err   error
+}
+
+func (b *fakeBackend) Run(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.args = append(b.args, args)
+	b.stdin = append(b.stdin, stdin)
+	return []byte(b.out), b.err
+}
+
+func (b *fakeBackend) Check() error {
+	return b.err
+}
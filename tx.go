@@ -0,0 +1,138 @@
+package ipset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrTxDone is returned by Commit if the Tx is already committed.
+var ErrTxDone = errors.New("ipset: transaction has already been committed")
+
+// Tx queues operations across sets and submits them by one
+// restore session on Commit. A Tx is not safe for concurrent use.
+type Tx struct {
+	client *Client
+	lines  []string
+	names  map[string]bool
+	exist  bool
+	done   bool
+	// err is the first invalid operation
+	err error
+}
+
+// Begin starts a Tx on the sets of the client.
+func (c *Client) Begin() *Tx {
+	return &Tx{client: c, names: make(map[string]bool)}
+}
+
+// Create queues the creation of a set, see New.
+func (tx *Tx) Create(name string, setType SetType, options ...Option) {
+	tx.queue(_create, name, setType, string(setType), options...)
+}
+
+// Add queues adding an entry to a set, see IPSet.Add.
+func (tx *Tx) Add(name, entry string, options ...Option) {
+	tx.queue(_add, name, "", entry, options...)
+}
+
+// Del queues deleting an entry from a set, see IPSet.Del.
+func (tx *Tx) Del(name, entry string, options ...Option) {
+	tx.queue(_del, name, "", entry, options...)
+}
+
+// Flush queues flushing a set.
+func (tx *Tx) Flush(name string) {
+	tx.queue(_flush, name, "", "")
+}
+
+// Rename queues renaming set from to to.
+func (tx *Tx) Rename(from, to string) {
+	tx.names[to] = true
+	tx.queue(_rename, from, "", to)
+}
+
+// Swap queues swapping the content of two sets, see Swap.
+func (tx *Tx) Swap(from, to string) {
+	tx.names[to] = true
+	tx.queue(_swap, from, "", to)
+}
+
+// Destroy queues destroying a set.
+func (tx *Tx) Destroy(name string) {
+	tx.queue(_destroy, name, "", "")
+}
+
+func (tx *Tx) queue(action, name string, setType SetType, entry string, options ...Option) {
+	c := getCmd(action, name, setType, entry)
+	err := c.check(options...)
+	if err == nil {
+		err = c.checkVersion(tx.client.backend, options...)
+	}
+	if err != nil && tx.err == nil {
+		tx.err = err
+	}
+	line, exist := restoreLine(c.buildArgs(options...))
+	putCmd(c)
+
+	// the exist flag is global to restore
+	tx.exist = tx.exist || exist
+	tx.names[name] = true
+	tx.lines = append(tx.lines, line)
+}
+
+// Commit submits the queued operations by one restore session.
+// The exist flag is global to restore, so one Exist option on any
+// queued operation applies -exist to every line, including the
+// create lines: creating a set which already exists with the same
+// type and options won't fail then.
+//
+// If an operation fails, the sets involved in the Tx are rolled
+// back to the state before Commit, which is saved beforehand for
+// these sets only, and the Line of the returned *RestoreError is
+// the number of the failed operation starting from 1.
+func (tx *Tx) Commit() error {
+	return tx.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit but aborts as soon as ctx is done.
+// The rollback on failure is done even if ctx is done.
+func (tx *Tx) CommitContext(ctx context.Context) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	if tx.err != nil || len(tx.lines) == 0 {
+		return tx.err
+	}
+
+	names := make([]string, 0, len(tx.names))
+	for name := range tx.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	snap, err := tx.client.snapshot(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	r := strings.NewReader(strings.Join(tx.lines, "\n") + "\n")
+	err = tx.client.RestoreAllContext(ctx, r, Exist(tx.exist))
+	var (
+		opErr      *OpError
+		restoreErr *RestoreError
+	)
+	if err == nil || !errors.As(err, &opErr) ||
+		errors.As(err, &restoreErr) && restoreErr.Line == 1 {
+		// nothing is applied
+		return err
+	}
+
+	selected := func(name string) bool { return tx.names[name] }
+	if e := tx.client.rollback(context.Background(), snap, selected); e != nil {
+		return fmt.Errorf("%w (can't roll back: %s)", err, e)
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package ipset
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Tx(t *testing.T) {
+	t.Parallel()
+
+	t.Run("commit", func(t *testing.T) {
+		b := &fakeBackend{}
+		tx := NewClient(b).Begin()
+		tx.Create("foo", HashIp, Timeout(time.Minute), Comment(true))
+		tx.Add("foo", "1.1.1.1", CommentContent("a b"), Exist(true))
+		tx.Del("bar", "2.2.2.2")
+		tx.Flush("bar")
+		tx.Swap("foo", "bar")
+		tx.Rename("foo", "baz")
+		tx.Destroy("baz")
+
+		require.Nil(t, tx.Commit())
+		assert.Equal(t, [][]string{{_save, "bar"}, {_save, "baz"}, {_save, "foo"}, {_restore, _exist}}, b.args)
+		assert.Equal(t, "create foo hash:ip timeout 60 comment\n"+
+			"add foo 1.1.1.1 comment \"a b\"\n"+
+			"del bar 2.2.2.2\n"+
+			"flush bar\n"+
+			"swap foo bar\n"+
+			"rename foo baz\n"+
+			"destroy baz\n", string(b.stdin[3]))
+
+		assert.Equal(t, ErrTxDone, tx.Commit())
+		assert.Nil(t, NewClient(b).Begin().Commit())
+		assert.Len(t, b.args, 4)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		b := &fakeBackend{}
+		tx := NewClient(b).Begin()
+		tx.Add("foo", "10.0.0.0/8", Nomatch(true), Strict(true))
+		tx.Del("foo", "10.0.0.0/8", Strict(true))
+
+		require.Nil(t, tx.Commit())
+		assert.Equal(t, "add foo 10.0.0.0/8 nomatch\ndel foo 10.0.0.0/8\n", string(b.stdin[1]))
+		assert.Equal(t, [][]string{{_save, "foo"}, {_restore}}, b.args)
+
+		tx = NewClient(b).Begin()
+		tx.Del("foo", "10.0.0.0/8", Nomatch(true), Strict(true))
+		err := tx.Commit()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "nomatch is not valid for del")
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		k := newFakeKernel()
+		c := NewClient(k.backend())
+		require.Nil(t, c.RestoreAll(strings.NewReader(
+			"create foo hash:ip\nadd foo 1.1.1.1\ncreate bar hash:ip\nadd bar 2.2.2.2\n"+
+				"create other hash:ip\nadd other 3.3.3.3\n")))
+		saved := &bytes.Buffer{}
+		require.Nil(t, c.SaveAll(saved))
+
+		tx := c.Begin()
+		tx.Add("foo", "1.1.1.2")
+		tx.Flush("bar")
+		tx.Create("new", HashNet)
+		tx.Destroy("foo")
+		tx.Add("new", "1.1.1.1")
+		tx.Add("new", "1.1.1.1")
+
+		err := tx.Commit()
+		var restoreErr *RestoreError
+		require.True(t, errors.As(err, &restoreErr))
+		assert.Equal(t, 6, restoreErr.Line)
+		assert.True(t, errors.Is(err, ErrEntryExists))
+
+		now := &bytes.Buffer{}
+		require.Nil(t, c.SaveAll(now))
+		// the destroyed set is recreated at the end
+		assert.ElementsMatch(t, strings.Split(saved.String(), "\n"), strings.Split(now.String(), "\n"))
+	})
+
+	t.Run("nothing applied", func(t *testing.T) {
+		k := newFakeKernel()
+		c := NewClient(k.backend())
+
+		tx := c.Begin()
+		tx.Add("foo", "1.1.1.1")
+		err := tx.Commit()
+		assert.True(t, errors.Is(err, ErrSetNotExist))
+	})
+}
@@ -867,3 +867,19 @@ const HashNetIface SetType = "hash:net,iface"
 //
 //      ipset add list baz before bar
 const ListSet SetType = "list:set"
+
+// setTypes are all the set types above.
+var setTypes = []SetType{
+	BitmapIp, BitmapIpMac, BitmapPort, HashIp, HashMac, HashIpMac,
+	HashNet, HashNetNet, HashIpPort, HashNetPort, HashIpPortIp,
+	HashIpPortNet, HashIpMark, HashNetPortNet, HashNetIface, ListSet,
+}
+
+func (t SetType) valid() bool {
+	for _, st := range setTypes {
+		if t == st {
+			return true
+		}
+	}
+	return false
+}
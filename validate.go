@@ -0,0 +1,327 @@
+package ipset
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidEntry is returned if an entry doesn't match the
+	// syntax of the set type, see SetType.ValidateEntry.
+	ErrInvalidEntry = errors.New("invalid entry")
+	// ErrInvalidOption is returned if an option is not valid for
+	// the command or the set type, see Strict.
+	ErrInvalidOption = errors.New("invalid option")
+)
+
+// ValidateEntry checks whether entry, the way it is given to Add,
+// Del and Test, matches the syntax of the set type: the number of
+// components, ip addresses, ranges, cidrs, [proto:]port, mac
+// addresses, marks, [physdev:]iface and set names. Host and
+// service names, which may be enclosed in square brackets, are
+// checked by syntax without being resolved.
+//
+// If header is not nil, the addresses must be of its family and
+// the entries of bitmap types must be in its range. The empty
+// family of a hash type is the default inet.
+func (t SetType) ValidateEntry(entry string, header *SetHeader) error {
+	if err := t.validateEntry(entry, header); err != nil {
+		return fmt.Errorf("%w %q of %s: %s", ErrInvalidEntry, entry, t, err)
+	}
+	return nil
+}
+
+func (t SetType) validateEntry(entry string, header *SetHeader) error {
+	if !t.valid() {
+		return errors.New("unknown set type")
+	}
+	if t == ListSet {
+		if entry == "" || len(entry) >= ipsetMaxNameLen {
+			return errors.New("invalid set name")
+		}
+		return nil
+	}
+
+	dims := t.dims()
+	parts := strings.Split(entry, ",")
+	if len(parts) != len(dims) && !(t == BitmapIpMac && len(parts) == 1) {
+		return fmt.Errorf("want %d components", len(dims))
+	}
+
+	v := &entryValidator{setType: t, header: header}
+	switch {
+	case t.method() == "bitmap":
+		v.family = Inet
+	case header != nil && t != HashMac:
+		if v.family = header.Family; v.family == "" {
+			v.family = Inet
+		}
+	}
+
+	for i, part := range parts {
+		var err error
+		switch dims[i] {
+		case "ip", "net":
+			// the second ip and the ip paired with a mac are single addresses
+			single := dims[i] == "ip" && (i > 0 || t == HashIpMac || t == BitmapIpMac)
+			err = v.ip(part, single)
+		case "port":
+			err = v.port(part)
+		case "mac":
+			err = validateMAC(part)
+		case "iface":
+			err = validateIface(part)
+		case "mark":
+			if _, e := strconv.ParseUint(part, 0, 32); e != nil {
+				err = fmt.Errorf("invalid mark %q", part)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryValidator checks the components of an entry. The family is
+// empty until it's known from the header or the first address.
+type entryValidator struct {
+	setType SetType
+	header  *SetHeader
+	family  NetFamily
+}
+
+// ip checks ip, ip/cidr or from-to, single allows ip only.
+func (v *entryValidator) ip(s string, single bool) error {
+	if from, to := splitRange(s); to != "" {
+		if single {
+			return fmt.Errorf("range %q is not allowed", s)
+		}
+		a, err := v.addr(from)
+		if err != nil {
+			return err
+		}
+		b, err := v.addr(to)
+		if err != nil {
+			return err
+		}
+		if a != nil && b != nil && bytes.Compare(a.To16(), b.To16()) > 0 {
+			return fmt.Errorf("invalid range %q", s)
+		}
+		return v.inRange(a, b)
+	}
+
+	var cidr string
+	if i := strings.LastIndexByte(s, '/'); i != -1 && !strings.HasPrefix(s, "[") {
+		if single {
+			return fmt.Errorf("cidr of %q is not allowed", s)
+		}
+		s, cidr = s[:i], s[i+1:]
+	}
+	ip, err := v.addr(s)
+	if err != nil {
+		return err
+	}
+	if cidr != "" {
+		bits := 8 * net.IPv4len
+		if v.family == Inet6 {
+			bits = 8 * net.IPv6len
+		}
+		if n, err := strconv.Atoi(cidr); err != nil || n < 1 || n > bits {
+			return fmt.Errorf("invalid cidr %q", cidr)
+		}
+	}
+	if ip != nil && ip.IsUnspecified() && v.setType == HashIp {
+		return errors.New("zero address can't be stored")
+	}
+	return v.inRange(ip, ip)
+}
+
+// addr checks an address or a host name which may be enclosed in
+// square brackets, the ip is nil for host names.
+func (v *entryValidator) addr(s string) (net.IP, error) {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	ip := net.ParseIP(s)
+	if ip == nil && v.family != Inet6 {
+		ip = parseShortIPv4(s)
+	}
+	if ip == nil {
+		if !validHostname(s) {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		return nil, nil
+	}
+
+	family := Inet
+	if ip.To4() == nil {
+		family = Inet6
+	}
+	if v.family == "" {
+		v.family = family
+	} else if v.family != family {
+		return nil, fmt.Errorf("%s is not an address of family %s", s, v.family)
+	}
+	return ip, nil
+}
+
+// inRange checks whether from-to is in the range of bitmap:ip and
+// bitmap:ip,mac.
+func (v *entryValidator) inRange(from, to net.IP) error {
+	if v.header == nil || v.header.Range == "" || from == nil || to == nil ||
+		v.setType != BitmapIp && v.setType != BitmapIpMac {
+		return nil
+	}
+
+	var first, last net.IP
+	if _, n, err := net.ParseCIDR(v.header.Range); err == nil {
+		first, last = n.IP.To4(), make(net.IP, net.IPv4len)
+		for i := range last {
+			last[i] = first[i] | ^n.Mask[i]
+		}
+	} else {
+		a, b := splitRange(v.header.Range)
+		first, last = net.ParseIP(a).To4(), net.ParseIP(b).To4()
+	}
+	if first == nil || last == nil {
+		return nil
+	}
+	if bytes.Compare(from.To4(), first) < 0 || bytes.Compare(to.To4(), last) > 0 {
+		return fmt.Errorf("out of range %s", v.header.Range)
+	}
+	return nil
+}
+
+// port checks [proto:]port or [proto:]from-to.
+func (v *entryValidator) port(s string) error {
+	proto := "tcp"
+	if i := strings.IndexByte(s, ':'); i != -1 && !strings.HasPrefix(s, "[") {
+		proto, s = s[:i], s[i+1:]
+	}
+	p, ok := protocols[proto]
+	if !ok {
+		n, err := strconv.ParseUint(proto, 10, 8)
+		if err != nil && !validName(proto) {
+			return fmt.Errorf("invalid protocol %q", proto)
+		}
+		if err == nil && n == 0 {
+			return errors.New("zero protocol can't be used")
+		}
+		p = uint8(n)
+	}
+	if v.setType == BitmapPort && p != protocols["tcp"] && p != protocols["udp"] {
+		return fmt.Errorf("protocol %s is not supported", proto)
+	}
+
+	switch p {
+	case protocols["icmp"], protocols["icmpv6"]:
+		family := Inet
+		if p == protocols["icmpv6"] {
+			family = Inet6
+		}
+		if v.family != "" && v.family != family {
+			return fmt.Errorf("%s is not a protocol of family %s", proto, v.family)
+		}
+		if _, err := parseICMP(protocolName(p), s); err != nil && !validName(s) {
+			return err
+		}
+		return nil
+	case protocols["tcp"], protocols["udp"], protocols["sctp"], protocols["udplite"]:
+	default:
+		if s != "0" {
+			return fmt.Errorf("port of protocol %s must be 0", proto)
+		}
+		return nil
+	}
+
+	from, to := splitRange(s)
+	a, err := validatePort(from)
+	if err != nil {
+		return err
+	}
+	b := a
+	if to != "" {
+		if b, err = validatePort(to); err != nil {
+			return err
+		}
+		if a > b && b != -1 {
+			return fmt.Errorf("invalid range %q", s)
+		}
+	}
+
+	if v.setType == BitmapPort && v.header != nil && v.header.Range != "" {
+		lo, hi := splitRange(v.header.Range)
+		first, err1 := strconv.Atoi(lo)
+		last, err2 := strconv.Atoi(hi)
+		if err1 == nil && err2 == nil && (a != -1 && a < first || b > last) {
+			return fmt.Errorf("out of range %s", v.header.Range)
+		}
+	}
+	return nil
+}
+
+// validatePort returns the port number, or -1 for a service name.
+func validatePort(s string) (int, error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err == nil && n <= 0xffff {
+		return int(n), nil
+	}
+	if err == nil || !validName(s) {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return -1, nil
+}
+
+func validateMAC(s string) error {
+	mac, err := net.ParseMAC(s)
+	if err != nil || len(mac) != 6 {
+		return fmt.Errorf("invalid mac %q", s)
+	}
+	if bytes.Equal(mac, make(net.HardwareAddr, 6)) {
+		return errors.New("zero mac can't be stored")
+	}
+	return nil
+}
+
+func validateIface(s string) error {
+	s = strings.TrimPrefix(s, "physdev:")
+	if s == "" || len(s) >= 16 || strings.ContainsAny(s, "/ \t") {
+		return fmt.Errorf("invalid iface %q", s)
+	}
+	return nil
+}
+
+// validHostname checks the syntax of a host name, the last label
+// of which can't be numeric to tell it from a bad ip address.
+func validHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	labels := strings.Split(s, ".")
+	for _, label := range labels {
+		if len(label) > 63 || !validName(label) || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+	}
+	_, err := strconv.Atoi(labels[len(labels)-1])
+	return err != nil
+}
+
+// validName checks the names of hosts, services and protocols.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package ipset
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SetType_ValidateEntry(t *testing.T) {
+	t.Parallel()
+
+	inet6 := &SetHeader{Family: Inet6}
+	cases := []struct {
+		setType SetType
+		entry   string
+		header  *SetHeader
+		valid   bool
+	}{
+		{BitmapIp, "192.168.0.1", nil, true},
+		{BitmapIp, "192.168.0.0/24", nil, true},
+		{BitmapIp, "192.168.0.1-192.168.0.9", nil, true},
+		{BitmapIp, "192.168.0.9-192.168.0.1", nil, false},
+		{BitmapIp, "192.168.0.1", &SetHeader{Range: "192.168.0.0/16"}, true},
+		{BitmapIp, "10.0.0.1", &SetHeader{Range: "192.168.0.0/16"}, false},
+		{BitmapIp, "192.168.0.1", &SetHeader{Range: "192.168.0.0-192.168.0.255"}, true},
+		{BitmapIp, "192.168.1.1", &SetHeader{Range: "192.168.0.0-192.168.0.255"}, false},
+		{BitmapIp, "::1", nil, false},
+		{BitmapIpMac, "192.168.0.1", nil, true},
+		{BitmapIpMac, "192.168.0.1,00:11:22:33:44:55", nil, true},
+		{BitmapIpMac, "192.168.0.0/24,00:11:22:33:44:55", nil, false},
+		{BitmapPort, "80", nil, true},
+		{BitmapPort, "udp:53", nil, true},
+		{BitmapPort, "[ftp-data]", nil, true},
+		{BitmapPort, "1024-2048", &SetHeader{Range: "0-1024"}, false},
+		{BitmapPort, "80-90", &SetHeader{Range: "0-1024"}, true},
+		{BitmapPort, "icmp:8/0", nil, false},
+		{HashIp, "1.1.1.1", nil, true},
+		{HashIp, "192.168.0/24", nil, true},
+		{HashIp, "[test-hostname]", nil, true},
+		{HashIp, "example.com", nil, true},
+		{HashIp, "::1", nil, true},
+		{HashIp, "::1", &SetHeader{}, false},
+		{HashIp, "::1", inet6, true},
+		{HashIp, "1.1.1.1", inet6, false},
+		{HashIp, "1.1.1.300", nil, false},
+		{HashIp, "0.0.0.0", nil, false},
+		{HashIp, "00:11:22:33:44:55", nil, false},
+		{HashIp, "1.1.1.1,80", nil, false},
+		{HashMac, "00:11:22:33:44:55", nil, true},
+		{HashMac, "00:00:00:00:00:00", nil, false},
+		{HashMac, "1.1.1.1", nil, false},
+		{HashIpMac, "1.1.1.1,00:11:22:33:44:55", nil, true},
+		{HashNet, "10.0.0.0/8", nil, true},
+		{HashNet, "10.0.0.0/0", nil, false},
+		{HashNet, "10.0.0.0/33", nil, false},
+		{HashNet, "2001:db8::/32", inet6, true},
+		{HashNet, "2001:db8::/129", inet6, false},
+		{HashNetNet, "10.0.0.0/8,192.168.0.0/16", nil, true},
+		{HashNetNet, "10.0.0.0/8,2001:db8::/32", nil, false},
+		{HashIpPort, "1.1.1.1,80", nil, true},
+		{HashIpPort, "192.168.1.0/24,80-82", nil, true},
+		{HashIpPort, "1.1.1.1,udp:53", nil, true},
+		{HashIpPort, "1.1.1.1,vrrp:0", nil, true},
+		{HashIpPort, "1.1.1.1,vrrp:1", nil, false},
+		{HashIpPort, "1.1.1.1,0:80", nil, false},
+		{HashIpPort, "1.1.1.1,tcp:70000", nil, false},
+		{HashIpPort, "1.1.1.1,icmp:8/0", nil, true},
+		{HashIpPort, "1.1.1.1,icmp:echo-request", nil, true},
+		{HashIpPort, "::1,icmp:8/0", inet6, false},
+		{HashIpPort, "::1,icmpv6:128/0", inet6, true},
+		{HashNetPort, "10.0.0.0/8,tcp:[ftp-data]", nil, true},
+		{HashIpPortIp, "1.1.1.1,80,2.2.2.2", nil, true},
+		{HashIpPortIp, "1.1.1.1,80,2.2.2.0/24", nil, false},
+		{HashIpPortNet, "1.1.1.1,80,2.2.2.0/24", nil, true},
+		{HashIpMark, "1.1.1.1,0x10", nil, true},
+		{HashIpMark, "1.1.1.1,0x100000000", nil, false},
+		{HashNetPortNet, "10.0.0.0/8,80,192.168.0.0/16", nil, true},
+		{HashNetIface, "10.0.0.0/8,eth0", nil, true},
+		{HashNetIface, "10.0.0.0/8,physdev:eth0", nil, true},
+		{HashNetIface, "10.0.0.0/8,physdev:", nil, false},
+		{HashNetIface, "10.0.0.0/8,averyveryverylongname", nil, false},
+		{ListSet, "foo", nil, true},
+		{ListSet, "", nil, false},
+		{SetType("hash:unknown"), "1.1.1.1", nil, false},
+	}
+	for _, c := range cases {
+		err := c.setType.ValidateEntry(c.entry, c.header)
+		if c.valid {
+			assert.Nil(t, err, "%s %s", c.setType, c.entry)
+		} else {
+			assert.True(t, errors.Is(err, ErrInvalidEntry), "%s %s", c.setType, c.entry)
+		}
+	}
+}
+
+func Test_Set_Validate(t *testing.T) {
+	t.Parallel()
+
+	b := &fakeBackend{}
+	c := NewClient(b)
+	s, err := c.New("foo", HashIp, Family(Inet6))
+	require.Nil(t, err)
+
+	err = s.Add("1.1.1.1")
+	assert.True(t, errors.Is(err, ErrInvalidEntry))
+	assert.Equal(t, `ipset: can't add foo 1.1.1.1: invalid entry "1.1.1.1" of hash:ip: `+
+		`1.1.1.1 is not an address of family inet6`, err.Error())
+	assert.True(t, errors.Is(s.Del("00:11:22:33:44:55"), ErrInvalidEntry))
+	_, err = s.Test("::1/200")
+	assert.True(t, errors.Is(err, ErrInvalidEntry))
+	assert.Len(t, b.args, 1)
+
+	require.Nil(t, s.Add("::1"))
+	assert.Len(t, b.args, 2)
+}
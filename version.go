@@ -0,0 +1,118 @@
+package ipset
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VersionInfo holds the versions of ipset and the set types it
+// supports, so that a set type can be chosen or fallen back by
+// the capabilities of the system.
+type VersionInfo struct {
+	// Version is the version of the ipset utility, i.e. v7.17.
+	// It's empty for the netlink backend.
+	Version string
+	// Major and Minor are the parts of Version.
+	Major, Minor int
+	// Protocol is the version of the ipset netlink protocol.
+	Protocol int
+	// Types are the revisions of the supported set types. The
+	// revisions are the ones the ipset utility supports for the
+	// exec backend, and the ones the kernel supports for the
+	// netlink backend.
+	Types map[SetType]Revisions
+}
+
+// Revisions is the range of the revisions of a set type.
+type Revisions struct {
+	Min, Max int
+}
+
+// Supports checks whether the set type is supported.
+func (v *VersionInfo) Supports(setType SetType) bool {
+	_, ok := v.Types[setType]
+	return ok
+}
+
+// Version returns the versions of ipset and the set types it
+// supports, see DetectVersion.
+func (c *Client) Version() (*VersionInfo, error) {
+	return c.VersionContext(context.Background())
+}
+
+// VersionContext is like Version but aborts as soon as ctx is
+// done.
+func (c *Client) VersionContext(ctx context.Context) (*VersionInfo, error) {
+	out, err := run(ctx, c.backend, _version, nil, _version)
+	if err != nil {
+		return nil, err
+	}
+	v := parseVersion(out)
+
+	if out, err = run(ctx, c.backend, _help, nil, _help); err != nil {
+		return nil, err
+	}
+	v.Types = parseTypes(out)
+	return v, nil
+}
+
+var (
+	fullVersionRegexp = regexp.MustCompile(` (v\d+(\.\d+)+)`)
+	protocolRegexp    = regexp.MustCompile(`protocol version: (\d+)`)
+)
+
+// parseVersion parses the output of ipset version, i.e.
+//      ipset v7.17, protocol version: 7
+func parseVersion(out []byte) *VersionInfo {
+	v := &VersionInfo{}
+	if m := fullVersionRegexp.FindSubmatch(out); m != nil {
+		v.Version = string(m[1])
+	}
+	v.Major, v.Minor = getVersion(out)
+	if m := protocolRegexp.FindSubmatch(out); m != nil {
+		v.Protocol, _ = strconv.Atoi(string(m[1]))
+	}
+	return v
+}
+
+// parseTypes parses the supported set types listed by ipset
+// help, one line per revision, i.e.
+//      Supported set types:
+//          hash:ip		5	bucketsize, initval support
+//          hash:ip		4	skbinfo support
+func parseTypes(out []byte) map[SetType]Revisions {
+	types := make(map[SetType]Revisions)
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if strings.HasPrefix(s.Text(), "Supported set types:") {
+			break
+		}
+	}
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			break
+		}
+		setType := SetType(fields[0])
+		rev, err := strconv.Atoi(fields[1])
+		if err != nil || !setType.valid() {
+			continue
+		}
+		r, ok := types[setType]
+		if !ok {
+			r = Revisions{rev, rev}
+		}
+		if rev < r.Min {
+			r.Min = rev
+		}
+		if rev > r.Max {
+			r.Max = rev
+		}
+		types[setType] = r
+	}
+	return types
+}
@@ -0,0 +1,66 @@
+package ipset
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const helpInfo = `ipset v7.17, protocol version: 7
+
+Usage: ipset [options] COMMAND
+
+Supported set types:
+    list:set		3	skbinfo support
+    list:set		2	comment support
+    hash:net,port,net	2	skbinfo support
+    hash:ip		6	bitmask support
+    hash:ip		5	bucketsize, initval support
+    hash:ip		4	skbinfo support
+    hash:unknown	1
+
+Type 'ipset help <TYPE>' for help on a specific set type.
+`
+
+func Test_Client_Version(t *testing.T) {
+	t.Parallel()
+
+	t.Run("exec", func(t *testing.T) {
+		b := &fakeBackend{out: helpInfo}
+		v, err := NewClient(b).Version()
+		require.Nil(t, err)
+		assert.Equal(t, [][]string{{_version}, {_help}}, b.args)
+		assert.Equal(t, &VersionInfo{
+			Version:  "v7.17",
+			Major:    7,
+			Minor:    17,
+			Protocol: 7,
+			Types: map[SetType]Revisions{
+				ListSet:        {2, 3},
+				HashNetPortNet: {2, 2},
+				HashIp:         {4, 6},
+			},
+		}, v)
+		assert.True(t, v.Supports(HashNetPortNet))
+		assert.False(t, v.Supports(HashNetIface))
+	})
+
+	t.Run("netlink", func(t *testing.T) {
+		k := newFakeKernel()
+		k.missing = map[string]bool{string(HashNetPortNet): true}
+		v, err := NewClient(k.backend()).Version()
+		require.Nil(t, err)
+		assert.Equal(t, "", v.Version)
+		assert.Equal(t, int(ipsetProtocolMin), v.Protocol)
+		assert.Len(t, v.Types, len(setTypes)-1)
+		assert.Equal(t, Revisions{0, 4}, v.Types[HashIp])
+		assert.False(t, v.Supports(HashNetPortNet))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := NewClient(&fakeBackend{out: "fake error", err: errors.New("exit")}).Version()
+		assert.Equal(t, "ipset: can't version: fake error", err.Error())
+	})
+}